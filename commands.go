@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"solar-scraper/internal/backfill"
+	"solar-scraper/internal/config"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/scheduler"
+	"solar-scraper/internal/scraper"
+	"solar-scraper/internal/sink"
+	"strings"
+	"time"
+)
+
+const (
+	ErrorOnceUsage     string = "usage: once [-write]"
+	ErrorPingFailed    string = "ping failed"
+	ErrorReportUsage   string = "usage: report daily|monthly [sink]"
+	ErrorNoSQLiteSink  string = "no sqlite sink configured"
+	ErrorBackfillUsage string = "usage: backfill [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-sinks a,b] file"
+	ErrorReplayUsage   string = "usage: replay [-write] [-sinks a,b] directory"
+	ErrorUnknownSink   string = "unknown sink"
+	ErrorNoHistory     string = "sink does not store history"
+	ErrorNoHistorySink string = "no sink stores history"
+)
+
+// once scrapes the inverter a single time and prints the reading, with -write the reading is also written to the sinks
+func once(config config.Settings, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("once", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	write := flags.Bool("write", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return errors.New(ErrorOnceUsage)
+	}
+	metrics, reportingTime, _, err := scrape(config, log)
+	if err != nil {
+		return err
+	}
+	printMetrics(os.Stdout, metrics, reportingTime)
+	if !*write {
+		return nil
+	}
+	metricsWriter, err := config.Sinks.CreateWriter()
+	if err != nil {
+		return err
+	}
+	defer metricsWriter.Close()
+	return metricsWriter.Write(metrics, reportingTime, log)
+}
+
+// ping checks if the inverter and every sink are reachable
+func ping(config config.Settings, log *slog.Logger) error {
+	failed := false
+	if _, _, attempts, err := scrape(config, log); err != nil {
+		fmt.Printf("inverter: %s\n", err)
+		failed = true
+	} else {
+		fmt.Printf("inverter: ok, %d attempt(s)\n", attempts)
+	}
+	for _, name := range config.Sinks.Names() {
+		if err := pingSink(name, config.Sinks[name]); err != nil {
+			fmt.Println(err)
+			failed = true
+		} else {
+			fmt.Printf("sink %s: ok\n", name)
+		}
+	}
+	if failed {
+		return errors.New(ErrorPingFailed)
+	}
+	return nil
+}
+
+// pingSink creates the sink to check if it is reachable and closes it again
+func pingSink(name string, settings sink.Settings) error {
+	writer, err := settings.CreateWriter()
+	if err != nil {
+		return fmt.Errorf("sink %s: %w", name, err)
+	}
+	metricsWriter := &sink.Multi{}
+	metricsWriter.Add(name, writer)
+	defer metricsWriter.Close()
+	return metricsWriter.Ping()
+}
+
+// validate is only reached with a valid config, the config is read before the command runs
+func validate() error {
+	_, err := fmt.Println("config is valid")
+	return err
+}
+
+// printConfig prints the effective config with secrets redacted
+func printConfig(config config.Settings) error {
+	return config.Print(os.Stdout)
+}
+
+// report prints the yield table of the named sqlite sink, or of the first one when no name is given
+func report(sinks sink.Collection, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New(ErrorReportUsage)
+	}
+	_, settings, ok := sinks.First(sink.TypeSQLite)
+	if len(args) == 2 {
+		settings, ok = sinks[args[1]]
+		ok = ok && settings.Type == sink.TypeSQLite
+	}
+	if !ok {
+		return errors.New(ErrorNoSQLiteSink)
+	}
+	return settings.SQLite.PrintReport(args[0], os.Stdout)
+}
+
+// runBackfill writes the readings of the file in the date range to the sinks with their original time
+func runBackfill(config config.Settings, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	from := flags.String("from", "", "")
+	to := flags.String("to", "", "")
+	names := flags.String("sinks", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(ErrorBackfillUsage)
+	}
+	dates, err := backfill.ParseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	path := flags.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	points, err := backfill.Read(file, backfill.Format(path))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	sinks, err := historySinks(config.Sinks, *names, log)
+	if err != nil {
+		return err
+	}
+	// Every sink is written on its own, so a failing sink does not stop the others
+	var errs []error
+	for _, name := range sinks.Names() {
+		result, err := backfillSink(name, sinks[name], points, dates, log)
+		fmt.Printf("sink %s: %d written, %d already stored, %d outside the range\n", name, result.Written, result.Skipped, result.OutOfRange)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// historySinks selects the sinks that store metrics with their report time, selecting another sink by name is an error
+func historySinks(sinks sink.Collection, names string, log *slog.Logger) (sink.Collection, error) {
+	selected, err := selectSinks(sinks, names)
+	if err != nil {
+		return nil, err
+	}
+	history := sink.Collection{}
+	for _, name := range selected.Names() {
+		if selected[name].History() {
+			history[name] = selected[name]
+			continue
+		}
+		if names != "" {
+			return nil, errors.New(ErrorNoHistory + ": " + name)
+		}
+		log.Info("sink skipped, it does not store history", "sink", name)
+	}
+	if len(history) == 0 {
+		return nil, errors.New(ErrorNoHistorySink)
+	}
+	return history, nil
+}
+
+// backfillSink writes the points in the range to a single sink
+func backfillSink(name string, settings sink.Settings, points []backfill.Point, dates backfill.Range, log *slog.Logger) (backfill.Result, error) {
+	writer, err := settings.CreateWriter()
+	if err != nil {
+		return backfill.Result{}, fmt.Errorf("sink %s: %w", name, err)
+	}
+	metricsWriter := &sink.Multi{}
+	metricsWriter.Add(name, writer)
+	defer metricsWriter.Close()
+	if err = metricsWriter.Ping(); err != nil {
+		return backfill.Result{}, err
+	}
+	return backfill.Run(points, dates, metricsWriter, log)
+}
+
+// replay passes recorded responses through the extraction, the plausibility check and the substitution and prints the readings,
+// with -write the readings are written to the sinks instead
+func replay(config config.Settings, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	write := flags.Bool("write", false, "")
+	names := flags.String("sinks", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(ErrorReplayUsage)
+	}
+	recordings, err := scraper.ReadRecordings(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var metricsWriter influx.MetricsWriter = printer{w: os.Stdout}
+	if *write {
+		sinks, err := selectSinks(config.Sinks, *names)
+		if err != nil {
+			return err
+		}
+		multi, err := sinks.Open(log)
+		if err != nil {
+			return err
+		}
+		defer multi.Close()
+		metricsWriter = multi
+	}
+	result := scheduler.Replay(recordings, config.Scheduler(), metricsWriter, log)
+	fmt.Printf("%d recordings, %d failed, %d written, %d dropped\n", len(recordings), result.Failed, result.Written, result.Dropped)
+	return nil
+}
+
+// printer is a MetricsWriter that prints the metrics
+type printer struct {
+	w io.Writer
+}
+
+// Ping always succeeds
+func (p printer) Ping() error {
+	return nil
+}
+
+// Write prints the metrics followed by an empty line
+func (p printer) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	printMetrics(p.w, metrics, reportTime)
+	_, err := fmt.Fprintln(p.w)
+	return err
+}
+
+// selectSinks returns the sinks with the comma separated names, every sink when no names are given
+func selectSinks(sinks sink.Collection, names string) (sink.Collection, error) {
+	if names == "" {
+		return sinks, nil
+	}
+	selected := sink.Collection{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		settings, ok := sinks[name]
+		if !ok {
+			return nil, errors.New(ErrorUnknownSink + ": " + name)
+		}
+		selected[name] = settings
+	}
+	return selected, nil
+}
+
+// schema prints the JSON Schema of the config file
+func schema() error {
+	output, err := config.Schema()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(string(output))
+	return err
+}
+
+// scrape gets a single reading from the inverter and checks if it is plausible
+func scrape(config config.Settings, log *slog.Logger) (influx.SolarMetrics, time.Time, uint, error) {
+	credentials := scraper.EncodeCredentials(config.Scraper.Username, config.Scraper.Password)
+	metrics, reportingTime, attempts, err := scraper.GetMetrics(config.Scraper.URL, credentials, config.Scraper.Retry, config.Scraper.NewRecorder(), log.With("inverter", config.Scraper.URL))
+	if err == nil {
+		err = config.Plausibility.NewChecker().Check(metrics, reportingTime)
+	}
+	return metrics, reportingTime, attempts, err
+}
+
+func printMetrics(w io.Writer, metrics influx.SolarMetrics, reportingTime time.Time) {
+	fmt.Fprintf(w, "Time:         %s\n", reportingTime.Format(time.RFC3339))
+	if metrics.NowNil {
+		fmt.Fprintln(w, "CurrentPower: substituted")
+	} else {
+		fmt.Fprintf(w, "CurrentPower: %d W\n", metrics.Now)
+	}
+	fmt.Fprintf(w, "YieldToday:   %.2f kWh\n", metrics.Today)
+	fmt.Fprintf(w, "TotalYield:   %.2f kWh\n", metrics.Total)
+	if metrics.Alarm != "" {
+		fmt.Fprintf(w, "Alarm:        %s\n", metrics.Alarm)
+	}
+}
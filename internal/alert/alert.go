@@ -0,0 +1,269 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/notify"
+	"solar-scraper/internal/validation"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorNoChannels    string = "no channels configured for the enabled rules"
+	ErrorZeroDuration  string = "duration must be greater than 0"
+	ErrorZeroThreshold string = "threshold must be greater than 0"
+)
+
+// Names of the rules as used in the notifications
+const (
+	RuleInverterAlarm  string = "inverter_alarm"
+	RuleScrapeFailures string = "scrape_failures"
+	RuleTotalStalled   string = "total_stalled"
+	RuleZeroProduction string = "zero_production"
+)
+
+// queueSize is the number of notifications waiting to be sent before further ones are dropped
+const queueSize uint = 100
+
+// Settings is the configuration for the alerting
+type Settings struct {
+	Channels       notify.Collection      `mapstructure:"channels"`
+	InverterAlarm  InverterAlarmSettings  `mapstructure:"inverter_alarm"`
+	ScrapeFailures ScrapeFailuresSettings `mapstructure:"scrape_failures"`
+	Tags           influx.Tags            `mapstructure:"tags"`
+	TotalStalled   TotalStalledSettings   `mapstructure:"total_stalled"`
+	ZeroProduction ZeroProductionSettings `mapstructure:"zero_production"`
+}
+
+// InverterAlarmSettings fires while the inverter reports an alarm
+type InverterAlarmSettings struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// ScrapeFailuresSettings fires when the number of consecutive failed scrapes reaches the threshold
+type ScrapeFailuresSettings struct {
+	Enabled   bool `mapstructure:"enabled"`
+	Threshold uint `mapstructure:"threshold"`
+}
+
+// TotalStalledSettings fires when the total yield did not increase for the duration
+type TotalStalledSettings struct {
+	DurationInHours uint `mapstructure:"duration"`
+	Enabled         bool `mapstructure:"enabled"`
+}
+
+// ZeroProductionSettings fires when the current power is 0 for the duration inside the polling window
+type ZeroProductionSettings struct {
+	DurationInMinutes uint `mapstructure:"duration"`
+	Enabled           bool `mapstructure:"enabled"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	s.Channels.Defaults(v, setting+".channels")
+	v.SetDefault(setting+".inverter_alarm.enabled", false)
+	v.SetDefault(setting+".scrape_failures.enabled", false)
+	v.SetDefault(setting+".scrape_failures.threshold", uint(5))
+	s.Tags.Defaults(v, setting+".tags")
+	v.SetDefault(setting+".total_stalled.enabled", false)
+	v.SetDefault(setting+".total_stalled.duration", uint(24))
+	v.SetDefault(setting+".zero_production.enabled", false)
+	v.SetDefault(setting+".zero_production.duration", uint(30))
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	errs := []error{validation.Field("channels", s.Channels.Validate())}
+	if s.ScrapeFailures.Enabled && s.ScrapeFailures.Threshold == 0 {
+		errs = append(errs, validation.New(RuleScrapeFailures+".threshold", ErrorZeroThreshold))
+	}
+	if s.TotalStalled.Enabled && s.TotalStalled.DurationInHours == 0 {
+		errs = append(errs, validation.New(RuleTotalStalled+".duration", ErrorZeroDuration))
+	}
+	if s.ZeroProduction.Enabled && s.ZeroProduction.DurationInMinutes == 0 {
+		errs = append(errs, validation.New(RuleZeroProduction+".duration", ErrorZeroDuration))
+	}
+	if len(s.Channels) == 0 && len(s.rules()) > 0 {
+		errs = append(errs, validation.New("channels", ErrorNoChannels))
+	}
+	return errors.Join(errs...)
+}
+
+func (s Settings) rules() []rule {
+	rules := []rule{}
+	if s.InverterAlarm.Enabled {
+		rules = append(rules, &inverterAlarm{})
+	}
+	if s.ScrapeFailures.Enabled {
+		rules = append(rules, &scrapeFailures{threshold: s.ScrapeFailures.Threshold})
+	}
+	if s.TotalStalled.Enabled {
+		rules = append(rules, &totalStalled{duration: time.Duration(s.TotalStalled.DurationInHours) * time.Hour})
+	}
+	if s.ZeroProduction.Enabled {
+		rules = append(rules, &zeroProduction{duration: time.Duration(s.ZeroProduction.DurationInMinutes) * time.Minute})
+	}
+	return rules
+}
+
+// CreateEngine creates the engine that evaluates the enabled rules
+func (s Settings) CreateEngine(logger *slog.Logger) (*Engine, error) {
+	notifier, err := s.Channels.CreateNotifier(logger)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		rules: s.rules(),
+		// The rules are evaluated on every scrape, the channels are notified without delaying the scrapes
+		notifier: notify.NewQueue(notifier, queueSize, logger),
+		host:     s.Tags.Host,
+		firing:   map[string]bool{},
+	}, nil
+}
+
+// Engine evaluates the rules against every scrape and notifies when an alert starts firing or is resolved
+type Engine struct {
+	rules    []rule
+	notifier notify.Notifier
+	host     string
+	firing   map[string]bool
+}
+
+// observation is the result of a single scrape
+type observation struct {
+	metrics influx.SolarMetrics
+	err     error
+	time    time.Time
+}
+
+// rule is a single alerting rule, known is false when the observation does not change the state of the rule
+type rule interface {
+	name() string
+	evaluate(o observation) (firing bool, message string, known bool)
+	startWindow()
+}
+
+// StartWindow resets the rules that only apply inside the polling window
+func (e *Engine) StartWindow() {
+	for _, r := range e.rules {
+		r.startWindow()
+	}
+}
+
+// Evaluate evaluates all the rules against the scrape and sends a notification for every changed alert
+func (e *Engine) Evaluate(metrics influx.SolarMetrics, err error, scrapeTime time.Time) error {
+	var errs []error
+	o := observation{metrics: metrics, err: err, time: scrapeTime}
+	for _, r := range e.rules {
+		firing, message, known := r.evaluate(o)
+		if !known || firing == e.firing[r.name()] {
+			continue
+		}
+		if !firing {
+			message = "resolved"
+		}
+		if err := e.notifier.Notify(notify.Notification{
+			Host:    e.host,
+			Rule:    r.name(),
+			Firing:  firing,
+			Message: message,
+			Time:    scrapeTime,
+		}); err != nil {
+			// The state is kept, so the next scrape notifies again
+			errs = append(errs, err)
+			continue
+		}
+		e.firing[r.name()] = firing
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the engine, it returns once the queued notifications are sent
+func (e *Engine) Close() {
+	if closer, ok := e.notifier.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+type inverterAlarm struct{}
+
+func (r *inverterAlarm) name() string { return RuleInverterAlarm }
+
+func (r *inverterAlarm) startWindow() {}
+
+func (r *inverterAlarm) evaluate(o observation) (bool, string, bool) {
+	if o.err != nil {
+		return false, "", false
+	}
+	return o.metrics.Alarm != "", "inverter reports alarm " + o.metrics.Alarm, true
+}
+
+type scrapeFailures struct {
+	threshold uint
+	count     uint
+}
+
+func (r *scrapeFailures) name() string { return RuleScrapeFailures }
+
+func (r *scrapeFailures) startWindow() {}
+
+func (r *scrapeFailures) evaluate(o observation) (bool, string, bool) {
+	if o.err == nil {
+		r.count = 0
+		return false, "", true
+	}
+	r.count++
+	return r.count >= r.threshold, fmt.Sprintf("%d consecutive failed scrapes, last error: %s", r.count, o.err), true
+}
+
+type totalStalled struct {
+	duration     time.Duration
+	total        float64
+	lastIncrease time.Time
+}
+
+func (r *totalStalled) name() string { return RuleTotalStalled }
+
+func (r *totalStalled) startWindow() {}
+
+func (r *totalStalled) evaluate(o observation) (bool, string, bool) {
+	if o.err != nil {
+		return false, "", false
+	}
+	if r.lastIncrease.IsZero() || o.metrics.Total > r.total {
+		r.total = o.metrics.Total
+		r.lastIncrease = o.time
+	}
+	stalled := o.time.Sub(r.lastIncrease)
+	return stalled >= r.duration, fmt.Sprintf("total yield stuck at %g kWh since %s", r.total, r.lastIncrease.Format(time.RFC3339)), true
+}
+
+type zeroProduction struct {
+	duration  time.Duration
+	zeroSince time.Time
+}
+
+func (r *zeroProduction) name() string { return RuleZeroProduction }
+
+// startWindow forgets the zero production of the previous window, there is no production outside the window
+func (r *zeroProduction) startWindow() {
+	r.zeroSince = time.Time{}
+}
+
+func (r *zeroProduction) evaluate(o observation) (bool, string, bool) {
+	if o.err != nil || o.metrics.NowNil {
+		return false, "", false
+	}
+	if o.metrics.Now > 0 {
+		r.zeroSince = time.Time{}
+		return false, "", true
+	}
+	if r.zeroSince.IsZero() {
+		r.zeroSince = o.time
+	}
+	return o.time.Sub(r.zeroSince) >= r.duration, "no production since " + r.zeroSince.Format(time.RFC3339), true
+}
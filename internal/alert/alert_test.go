@@ -0,0 +1,199 @@
+package alert
+
+import (
+	"errors"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/notify"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testNotifier struct {
+	err           error
+	notifications []notify.Notification
+}
+
+func (n *testNotifier) Notify(notification notify.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+type step struct {
+	minutes int
+	metrics influx.SolarMetrics
+	err     error
+}
+
+type expected struct {
+	rule    string
+	firing  bool
+	minutes int
+}
+
+func Test_Engine_Evaluate(t *testing.T) {
+	scrapeErr := errors.New("test error")
+	tests := []struct {
+		name     string
+		settings Settings
+		steps    []step
+		output   []expected
+	}{
+		{name: "Zero production fires once and resolves",
+			settings: Settings{ZeroProduction: ZeroProductionSettings{Enabled: true, DurationInMinutes: 30}},
+			steps: []step{
+				{minutes: 0, metrics: influx.SolarMetrics{Now: 0}},
+				{minutes: 20, metrics: influx.SolarMetrics{Now: 0}},
+				{minutes: 25, err: scrapeErr},
+				{minutes: 30, metrics: influx.SolarMetrics{Now: 0}},
+				{minutes: 40, metrics: influx.SolarMetrics{Now: 0}},
+				{minutes: 45, metrics: influx.SolarMetrics{NowNil: true}},
+				{minutes: 50, metrics: influx.SolarMetrics{Now: 100}},
+			},
+			output: []expected{
+				{rule: RuleZeroProduction, firing: true, minutes: 30},
+				{rule: RuleZeroProduction, firing: false, minutes: 50},
+			},
+		},
+		{name: "Zero production interrupted",
+			settings: Settings{ZeroProduction: ZeroProductionSettings{Enabled: true, DurationInMinutes: 30}},
+			steps: []step{
+				{minutes: 0, metrics: influx.SolarMetrics{Now: 0}},
+				{minutes: 20, metrics: influx.SolarMetrics{Now: 10}},
+				{minutes: 40, metrics: influx.SolarMetrics{Now: 0}},
+			},
+		},
+		{name: "Inverter alarm",
+			settings: Settings{InverterAlarm: InverterAlarmSettings{Enabled: true}},
+			steps: []step{
+				{minutes: 0, metrics: influx.SolarMetrics{Now: 100}},
+				{minutes: 1, metrics: influx.SolarMetrics{Now: 0, Alarm: "F07"}},
+				{minutes: 2, err: scrapeErr},
+				{minutes: 3, metrics: influx.SolarMetrics{Now: 0, Alarm: "F07"}},
+				{minutes: 4, metrics: influx.SolarMetrics{Now: 100}},
+			},
+			output: []expected{
+				{rule: RuleInverterAlarm, firing: true, minutes: 1},
+				{rule: RuleInverterAlarm, firing: false, minutes: 4},
+			},
+		},
+		{name: "Scrape failures",
+			settings: Settings{ScrapeFailures: ScrapeFailuresSettings{Enabled: true, Threshold: 2}},
+			steps: []step{
+				{minutes: 0, err: scrapeErr},
+				{minutes: 1, metrics: influx.SolarMetrics{Now: 100}},
+				{minutes: 2, err: scrapeErr},
+				{minutes: 3, err: scrapeErr},
+				{minutes: 4, err: scrapeErr},
+				{minutes: 5, metrics: influx.SolarMetrics{Now: 100}},
+			},
+			output: []expected{
+				{rule: RuleScrapeFailures, firing: true, minutes: 3},
+				{rule: RuleScrapeFailures, firing: false, minutes: 5},
+			},
+		},
+		{name: "Total stalled",
+			settings: Settings{TotalStalled: TotalStalledSettings{Enabled: true, DurationInHours: 1}},
+			steps: []step{
+				{minutes: 0, metrics: influx.SolarMetrics{Total: 100}},
+				{minutes: 30, metrics: influx.SolarMetrics{Total: 100.5}},
+				{minutes: 60, metrics: influx.SolarMetrics{Total: 100.5}},
+				{minutes: 90, metrics: influx.SolarMetrics{Total: 100.5}},
+				{minutes: 100, metrics: influx.SolarMetrics{Total: 100.5}},
+				{minutes: 110, metrics: influx.SolarMetrics{Total: 101}},
+			},
+			output: []expected{
+				{rule: RuleTotalStalled, firing: true, minutes: 90},
+				{rule: RuleTotalStalled, firing: false, minutes: 110},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+			notifier := &testNotifier{}
+			engine := &Engine{rules: test.settings.rules(), notifier: notifier, host: "my-host", firing: map[string]bool{}}
+			engine.StartWindow()
+			for _, s := range test.steps {
+				require.NoError(t, engine.Evaluate(s.metrics, s.err, start.Add(time.Duration(s.minutes)*time.Minute)), test.name)
+			}
+			require.Len(t, notifier.notifications, len(test.output), test.name)
+			for i, e := range test.output {
+				require.Equal(t, e.rule, notifier.notifications[i].Rule, test.name)
+				require.Equal(t, e.firing, notifier.notifications[i].Firing, test.name)
+				require.Equal(t, start.Add(time.Duration(e.minutes)*time.Minute), notifier.notifications[i].Time, test.name)
+				require.Equal(t, "my-host", notifier.notifications[i].Host, test.name)
+			}
+		})
+	}
+}
+
+func Test_Engine_StartWindow(t *testing.T) {
+	start := time.Date(2023, 6, 1, 20, 0, 0, 0, time.UTC)
+	notifier := &testNotifier{}
+	engine := &Engine{rules: Settings{ZeroProduction: ZeroProductionSettings{Enabled: true, DurationInMinutes: 30}}.rules(), notifier: notifier, firing: map[string]bool{}}
+	require.NoError(t, engine.Evaluate(influx.SolarMetrics{Now: 0}, nil, start))
+	// The next morning the zero production of the previous evening is forgotten
+	engine.StartWindow()
+	require.NoError(t, engine.Evaluate(influx.SolarMetrics{Now: 0}, nil, start.Add(10*time.Hour)))
+	require.Empty(t, notifier.notifications)
+}
+
+func Test_Engine_Evaluate_NotifyFailed(t *testing.T) {
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	notifier := &testNotifier{err: errors.New(notify.ErrorQueueFull)}
+	engine := &Engine{rules: Settings{InverterAlarm: InverterAlarmSettings{Enabled: true}}.rules(), notifier: notifier, firing: map[string]bool{}}
+	require.Error(t, engine.Evaluate(influx.SolarMetrics{Alarm: "E01"}, nil, start))
+	// The alert was not sent, so the next scrape sends it
+	notifier.err = nil
+	require.NoError(t, engine.Evaluate(influx.SolarMetrics{Alarm: "E01"}, nil, start.Add(time.Minute)))
+	require.Len(t, notifier.notifications, 1)
+	require.True(t, notifier.notifications[0].Firing)
+	require.NoError(t, engine.Evaluate(influx.SolarMetrics{Alarm: "E01"}, nil, start.Add(2*time.Minute)))
+	require.Len(t, notifier.notifications, 1)
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Settings
+		output string
+	}{
+		{name: "Valid nothing enabled",
+			input: Settings{},
+		},
+		{name: "Valid",
+			input: Settings{Channels: notify.Collection{"log": {Type: notify.TypeLog}}, InverterAlarm: InverterAlarmSettings{Enabled: true}},
+		},
+		{name: "ErrorNoChannels",
+			input:  Settings{InverterAlarm: InverterAlarmSettings{Enabled: true}},
+			output: "channels: " + ErrorNoChannels,
+		},
+		{name: "ErrorZeroThreshold",
+			input:  Settings{Channels: notify.Collection{"log": {Type: notify.TypeLog}}, ScrapeFailures: ScrapeFailuresSettings{Enabled: true}},
+			output: RuleScrapeFailures + ".threshold: " + ErrorZeroThreshold,
+		},
+		{name: "ErrorZeroDuration",
+			input:  Settings{Channels: notify.Collection{"log": {Type: notify.TypeLog}}, ZeroProduction: ZeroProductionSettings{Enabled: true}},
+			output: RuleZeroProduction + ".duration: " + ErrorZeroDuration,
+		},
+		{name: "Error invalid channel",
+			input:  Settings{Channels: notify.Collection{"log": {Type: "invalid"}}},
+			output: "channels.log.type: " + notify.ErrorInvalidType,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
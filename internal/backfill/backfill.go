@@ -0,0 +1,298 @@
+package backfill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"solar-scraper/internal/influx"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ErrorInvalidDate      string = "invalid date, expected YYYY-MM-DD"
+	ErrorInvalidFormat    string = "invalid format, expected csv, json or jsonl"
+	ErrorInvalidRange     string = "from is after to"
+	ErrorInvalidTimestamp string = "invalid timestamp, expected RFC 3339, YYYY-MM-DD HH:MM:SS or unix seconds"
+	ErrorMissingColumn    string = "missing column"
+)
+
+// Supported file formats, the formats of the file sink can be read back
+const (
+	FormatCSV   string = "csv"
+	FormatJSON  string = "json"
+	FormatJSONL string = "jsonl"
+)
+
+const dayFormat string = "2006-01-02"
+
+// columns are the accepted CSV header names of every value, data logger exports name them differently
+var columns = map[string][]string{
+	"timestamp":   {"timestamp", "time", "date"},
+	"now":         {"now", "power", "current_power", "currentpower"},
+	"today":       {"today", "yield_today", "yieldtoday", "e_today"},
+	"total":       {"total", "total_yield", "totalyield", "e_total"},
+	"substituted": {"substituted"},
+}
+
+// Point is a single historic reading
+type Point struct {
+	Time    time.Time
+	Metrics influx.SolarMetrics
+}
+
+// Format returns the format of the file by its extension, unknown extensions are read as CSV
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// Read reads the points of the file, ordered by time
+func Read(r io.Reader, format string) ([]Point, error) {
+	var points []Point
+	var err error
+	switch format {
+	case FormatCSV:
+		points, err = readCSV(r)
+	case FormatJSON:
+		points, err = readJSON(r)
+	case FormatJSONL:
+		points, err = readJSONL(r)
+	default:
+		err = errors.New(ErrorInvalidFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+func readCSV(r io.Reader) ([]Point, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range columns {
+			for _, alias := range aliases {
+				if _, found := index[column]; !found && name == alias {
+					index[column] = i
+				}
+			}
+		}
+	}
+	for _, column := range []string{"timestamp", "today", "total"} {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("%s: %s", ErrorMissingColumn, column)
+		}
+	}
+	var points []Point
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i, ok := index[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		point, err := newPoint(value("timestamp"), value("now"), value("today"), value("total"), value("substituted"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		points = append(points, point)
+	}
+}
+
+// record is a single reading of a JSON file, the fields of the JSON-lines file sink
+type record struct {
+	Timestamp   json.RawMessage `json:"timestamp"`
+	Now         *float64        `json:"now"`
+	Today       float64         `json:"today"`
+	Total       float64         `json:"total"`
+	Substituted bool            `json:"substituted"`
+}
+
+func (r record) point() (Point, error) {
+	// The timestamp is either a string or unix seconds
+	timestamp := string(r.Timestamp)
+	if unquoted, err := strconv.Unquote(timestamp); err == nil {
+		timestamp = unquoted
+	}
+	pointTime, err := parseTimestamp(timestamp)
+	if err != nil {
+		return Point{}, err
+	}
+	metrics := influx.SolarMetrics{Today: r.Today, Total: r.Total, NowNil: r.Now == nil || r.Substituted}
+	if !metrics.NowNil {
+		metrics.Now = uint(math.Round(math.Max(*r.Now, 0)))
+	}
+	return Point{Time: pointTime, Metrics: metrics}, nil
+}
+
+func readJSON(r io.Reader) ([]Point, error) {
+	var records []record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	points := make([]Point, len(records))
+	for i, rec := range records {
+		var err error
+		if points[i], err = rec.point(); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+	return points, nil
+}
+
+func readJSONL(r io.Reader) ([]Point, error) {
+	var points []Point
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		point, err := rec.point()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		points = append(points, point)
+	}
+	return points, scanner.Err()
+}
+
+// newPoint parses the values of a CSV row, an empty current power is handled like a substituted reading
+func newPoint(timestamp, now, today, total, substituted string) (Point, error) {
+	pointTime, err := parseTimestamp(timestamp)
+	if err != nil {
+		return Point{}, err
+	}
+	point := Point{Time: pointTime}
+	if point.Metrics.Today, err = strconv.ParseFloat(today, 64); err != nil {
+		return Point{}, fmt.Errorf("today: %w", err)
+	}
+	if point.Metrics.Total, err = strconv.ParseFloat(total, 64); err != nil {
+		return Point{}, fmt.Errorf("total: %w", err)
+	}
+	if isSubstituted, _ := strconv.ParseBool(substituted); isSubstituted || now == "" {
+		point.Metrics.NowNil = true
+		return point, nil
+	}
+	power, err := strconv.ParseFloat(now, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("now: %w", err)
+	}
+	point.Metrics.Now = uint(math.Round(math.Max(power, 0)))
+	return point, nil
+}
+
+// parseTimestamp parses RFC 3339, a local date and time or unix seconds
+func parseTimestamp(timestamp string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return parsed, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if parsed, err := time.ParseInLocation(layout, timestamp, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, errors.New(ErrorInvalidTimestamp)
+}
+
+// Range is a range of days, a zero bound is open
+type Range struct {
+	From time.Time // Start of the first day
+	To   time.Time // Start of the day after the last day
+}
+
+// ParseRange parses the first and the last day of the range in local time, both are included and can be empty
+func ParseRange(from, to string) (Range, error) {
+	var r Range
+	var err error
+	if from != "" {
+		if r.From, err = time.ParseInLocation(dayFormat, from, time.Local); err != nil {
+			return r, fmt.Errorf("from: %s", ErrorInvalidDate)
+		}
+	}
+	if to != "" {
+		if r.To, err = time.ParseInLocation(dayFormat, to, time.Local); err != nil {
+			return r, fmt.Errorf("to: %s", ErrorInvalidDate)
+		}
+		r.To = r.To.AddDate(0, 0, 1)
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return r, errors.New(ErrorInvalidRange)
+	}
+	return r, nil
+}
+
+// Contains checks if the time is in the range
+func (r Range) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// Writer writes metrics to the sinks that do not have them yet, implemented by sink.Multi
+type Writer interface {
+	WriteMissing(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) (uint, error)
+}
+
+// Result counts the points of a backfill
+type Result struct {
+	Written    uint // Written to at least one sink
+	Skipped    uint // Already present in every sink
+	OutOfRange uint
+}
+
+// Run writes the points in the range with their original time, it stops at the first point that can not be written
+func Run(points []Point, dates Range, writer Writer, logger *slog.Logger) (Result, error) {
+	var result Result
+	for _, point := range points {
+		if !dates.Contains(point.Time) {
+			result.OutOfRange++
+			continue
+		}
+		written, err := writer.WriteMissing(point.Metrics, point.Time, logger)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", point.Time.Format(time.RFC3339), err)
+		}
+		if written == 0 {
+			logger.Debug("point already present", "report_time", point.Time)
+			result.Skipped++
+			continue
+		}
+		result.Written++
+	}
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package backfill
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Read(t *testing.T) {
+	first := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	second := time.Date(2023, 6, 1, 10, 1, 0, 0, time.UTC)
+	expected := []Point{
+		{Time: first, Metrics: influx.SolarMetrics{Now: 150, Today: 1.5, Total: 100}},
+		{Time: second, Metrics: influx.SolarMetrics{NowNil: true, Today: 1.5, Total: 100}},
+	}
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		output []Point
+		err    string
+	}{
+		{name: "CSV of the file sink",
+			format: FormatCSV,
+			input:  "timestamp,now,today,total,substituted\n2023-06-01T10:01:00Z,,1.5,100,true\n2023-06-01T10:00:00Z,150,1.5,100,false\n",
+			output: expected,
+		},
+		{name: "CSV export with other column names",
+			format: FormatCSV,
+			input:  "Date, E_Total, E_Today, Power, Temperature\n1685613600, 100, 1.5, 149.6, 35\n1685613660, 100, 1.5, , 35\n",
+			output: expected,
+		},
+		{name: "JSON",
+			format: FormatJSON,
+			input:  `[{"timestamp":"2023-06-01T10:00:00Z","now":150,"today":1.5,"total":100},{"timestamp":1685613660,"today":1.5,"total":100}]`,
+			output: expected,
+		},
+		{name: "JSON-lines of the file sink",
+			format: FormatJSONL,
+			input:  `{"timestamp":"2023-06-01T10:00:00Z","now":150,"today":1.5,"total":100,"substituted":false}` + "\n\n" + `{"timestamp":"2023-06-01T10:01:00Z","now":null,"today":1.5,"total":100,"substituted":true}` + "\n",
+			output: expected,
+		},
+		{name: "ErrorMissingColumn",
+			format: FormatCSV,
+			input:  "timestamp,now,today\n",
+			err:    ErrorMissingColumn + ": total",
+		},
+		{name: "ErrorInvalidTimestamp",
+			format: FormatCSV,
+			input:  "timestamp,now,today,total\n2023-06-01T10:00:00Z,150,1.5,100\nyesterday,150,1.5,100\n",
+			err:    "line 3: " + ErrorInvalidTimestamp,
+		},
+		{name: "Invalid value",
+			format: FormatJSONL,
+			input:  `{"timestamp":"2023-06-01T10:00:00Z","now":"high","today":1.5,"total":100}`,
+			err:    "line 1: json: cannot unmarshal string into Go struct field record.now of type float64",
+		},
+		{name: "ErrorInvalidFormat",
+			format: "xml",
+			err:    ErrorInvalidFormat,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			points, err := Read(strings.NewReader(test.input), test.format)
+			if test.err != "" {
+				require.EqualError(t, err, test.err, test.name)
+				return
+			}
+			require.NoError(t, err, test.name)
+			require.Len(t, points, len(test.output), test.name)
+			for i := range points {
+				require.True(t, test.output[i].Time.Equal(points[i].Time), test.name)
+				require.Equal(t, test.output[i].Metrics, points[i].Metrics, test.name)
+			}
+		})
+	}
+}
+
+func Test_Format(t *testing.T) {
+	require.Equal(t, FormatCSV, Format("export.CSV"))
+	require.Equal(t, FormatJSON, Format("history.json"))
+	require.Equal(t, FormatJSONL, Format("solar.jsonl"))
+	require.Equal(t, FormatCSV, Format("export"))
+}
+
+func Test_ParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		inside  []time.Time
+		outside []time.Time
+		err     string
+	}{
+		{name: "Both days included",
+			from:    "2023-06-01",
+			to:      "2023-06-02",
+			inside:  []time.Time{time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local), time.Date(2023, 6, 2, 23, 59, 59, 0, time.Local)},
+			outside: []time.Time{time.Date(2023, 5, 31, 23, 59, 59, 0, time.Local), time.Date(2023, 6, 3, 0, 0, 0, 0, time.Local)},
+		},
+		{name: "Open",
+			inside: []time.Time{time.Date(1999, 1, 1, 0, 0, 0, 0, time.Local), time.Date(2099, 1, 1, 0, 0, 0, 0, time.Local)},
+		},
+		{name: "ErrorInvalidDate",
+			from: "01.06.2023",
+			err:  "from: " + ErrorInvalidDate,
+		},
+		{name: "ErrorInvalidRange",
+			from: "2023-06-02",
+			to:   "2023-06-01",
+			err:  ErrorInvalidRange,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			dates, err := ParseRange(test.from, test.to)
+			if test.err != "" {
+				require.EqualError(t, err, test.err, test.name)
+				return
+			}
+			require.NoError(t, err, test.name)
+			for _, inside := range test.inside {
+				require.True(t, dates.Contains(inside), test.name+" "+inside.String())
+			}
+			for _, outside := range test.outside {
+				require.False(t, dates.Contains(outside), test.name+" "+outside.String())
+			}
+		})
+	}
+}
+
+// testWriter has the points at the times in present and fails at the time of fail
+type testWriter struct {
+	present map[time.Time]bool
+	fail    time.Time
+	written []time.Time
+}
+
+func (w *testWriter) WriteMissing(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) (uint, error) {
+	if reportTime.Equal(w.fail) {
+		return 0, errors.New("test error")
+	}
+	if w.present[reportTime] {
+		return 0, nil
+	}
+	w.written = append(w.written, reportTime)
+	return 1, nil
+}
+
+func Test_Run(t *testing.T) {
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	points := []Point{{Time: day.AddDate(0, 0, -1)}, {Time: day}, {Time: day.Add(time.Minute)}, {Time: day.AddDate(0, 0, 1)}}
+	dates, err := ParseRange("2023-06-01", "2023-06-01")
+	require.NoError(t, err)
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer := &testWriter{present: map[time.Time]bool{day: true}}
+	result, err := Run(points, dates, writer, discard)
+	require.NoError(t, err)
+	require.Equal(t, Result{Written: 1, Skipped: 1, OutOfRange: 2}, result)
+	require.Equal(t, []time.Time{day.Add(time.Minute)}, writer.written)
+
+	writer = &testWriter{fail: day}
+	result, err = Run(points, dates, writer, discard)
+	require.ErrorContains(t, err, "test error")
+	require.Equal(t, Result{OutOfRange: 1}, result)
+}
@@ -1,62 +1,170 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"path"
+	"os"
+	"path/filepath"
+	"reflect"
+	"solar-scraper/internal/alert"
+	"solar-scraper/internal/health"
 	"solar-scraper/internal/influx"
+	"solar-scraper/internal/logger"
+	"solar-scraper/internal/plausibility"
+	"solar-scraper/internal/scheduler"
 	"solar-scraper/internal/scraper"
+	"solar-scraper/internal/sink"
 	"solar-scraper/internal/timer"
+	"solar-scraper/internal/validation"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
+const (
+	// legacyInfluxDB is the name of the sink created from the top level influxdb settings
+	legacyInfluxDB string = "influxdb"
+)
+
+// formats are the supported config file formats by extension
+var formats = []string{"yml", "yaml", "json", "toml"}
+
+// format returns the format of the config file by its extension, unknown extensions are read as YAML
+func format(configPath string) string {
+	extension := strings.TrimPrefix(strings.ToLower(filepath.Ext(configPath)), ".")
+	for _, f := range formats {
+		if extension == f {
+			return f
+		}
+	}
+	return "yml"
+}
+
+// find returns the first config file in the directory named config with one of the supported extensions
+func find(directory string) (string, error) {
+	for _, f := range formats {
+		configPath := filepath.Join(directory, "config."+f)
+		if info, err := os.Stat(configPath); err == nil && !info.IsDir() {
+			return configPath, nil
+		}
+	}
+	return "", errors.New(ErrorConfigNotFound)
+}
+
+const (
+	ErrorConfigNotFound string = "config file not found, expected config.yml, config.yaml, config.json or config.toml"
+	ErrorDuplicateSink  string = "sink name already used by the top level influxdb settings"
+)
+
 // Settings is the configuration for the application
 type Settings struct {
-	Time     timer.Settings   `mapstructure:"time"`
-	Scraper  scraper.Settings `mapstructure:"scraper"`
-	InfluxDB influx.Settings  `mapstructure:"influxdb"`
+	Time         timer.Settings            `mapstructure:"time"`
+	Scraper      scraper.Settings          `mapstructure:"scraper"`
+	Plausibility plausibility.Settings     `mapstructure:"plausibility"`
+	Summary      scheduler.SummarySettings `mapstructure:"summary"`
+	InfluxDB     influx.Settings           `mapstructure:"influxdb"` // Kept for existing configs, added to Sinks under the name influxdb
+	Sinks        sink.Collection           `mapstructure:"sinks"`
+	Health       health.Settings           `mapstructure:"health"`
+	Alerts       alert.Settings            `mapstructure:"alerts"`
+	Log          logger.Settings           `mapstructure:"log"`
 }
 
-func (s *Settings) validate() error {
-	if err := s.Time.Validate(); err != nil {
-		return err
+func (s *Settings) validate(v *viper.Viper) error {
+	errs := []error{
+		validation.Field("time", s.Time.Validate()),
+		validation.Field("scraper", s.Scraper.Validate()),
+		validation.Field("plausibility", s.Plausibility.Validate()),
+		validation.Field("summary", s.Summary.Validate()),
+	}
+	legacy := v.IsSet("influxdb")
+	if legacy {
+		errs = append(errs, validation.Field("influxdb", s.InfluxDB.Validate()))
 	}
-	if err := s.Scraper.Validate(); err != nil {
-		return err
+	// The top level influxdb settings are enough when no other sinks are configured
+	if !legacy || len(s.Sinks) > 0 {
+		errs = append(errs, validation.Field("sinks", s.Sinks.Validate()))
 	}
-	return s.InfluxDB.Validate()
+	errs = append(errs,
+		validation.Field("health", s.Health.Validate()),
+		validation.Field("alerts", s.Alerts.Validate()),
+		validation.Field("log", s.Log.Validate()),
+	)
+	return errors.Join(errs...)
 }
 
-func (s Settings) defaults() {
-	s.Time.Defaults("time")
-	s.Scraper.Defaults("scraper")
-	s.InfluxDB.Defaults("influxdb")
+func (s Settings) defaults(v *viper.Viper) {
+	s.Time.Defaults(v, "time")
+	s.Scraper.Defaults(v, "scraper")
+	s.Plausibility.Defaults(v, "plausibility")
+	s.Summary.Defaults(v, "summary")
+	if v.IsSet("influxdb") {
+		s.InfluxDB.Defaults(v, "influxdb")
+	}
+	s.Sinks.Defaults(v, "sinks")
+	s.Health.Defaults(v, "health")
+	s.Alerts.Defaults(v, "alerts")
+	s.Log.Defaults(v, "log")
 }
 
-func Get(configPath string) (Settings, error) {
+// addLegacyInfluxDB adds the top level influxdb settings as a sink
+func (s *Settings) addLegacyInfluxDB(v *viper.Viper) error {
+	if !v.IsSet("influxdb") {
+		return nil
+	}
+	if s.Sinks == nil {
+		s.Sinks = sink.Collection{}
+	}
+	if _, ok := s.Sinks[legacyInfluxDB]; ok {
+		return errors.New(ErrorDuplicateSink)
+	}
+	s.Sinks[legacyInfluxDB] = sink.Settings{Type: sink.TypeInfluxDB, InfluxDB: s.InfluxDB}
+	return nil
+}
 
-	// Set the path to look for the configurations file
-	if len(configPath) == 0 {
-		viper.SetConfigName("config")
-		viper.AddConfigPath(".")
-	} else {
-		viper.SetConfigName(path.Base(configPath))
-		viper.AddConfigPath(path.Dir(configPath))
+// Scheduler returns the settings used by the scheduler
+func (s Settings) Scheduler() scheduler.Settings {
+	return scheduler.Settings{
+		Time:         s.Time,
+		Scraper:      s.Scraper,
+		Summary:      s.Summary,
+		Plausibility: s.Plausibility,
 	}
+}
 
-	viper.SetConfigType("yml")
+func Get(configPath string) (Settings, error) {
 
 	var configuration Settings
-	if err := viper.ReadInConfig(); err != nil {
+	// Without a path config.yml, config.yaml, config.json or config.toml in the working directory is used
+	if len(configPath) == 0 {
+		var err error
+		if configPath, err = find("."); err != nil {
+			return configuration, fmt.Errorf("error reading config file, %s", err)
+		}
+	}
+	// Every call reads into a new instance, so a reload does not see the settings of the previous file
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	v.SetConfigType(format(configPath))
+	if err := v.ReadInConfig(); err != nil {
 		return configuration, fmt.Errorf("error reading config file, %s", err)
 	}
 
-	configuration.defaults()
-	if err := viper.Unmarshal(&configuration); err != nil {
-		return configuration, fmt.Errorf("unable to decode into struct, %v", err)
+	if err := addEnvEntries(v, "", reflect.TypeOf(configuration)); err != nil {
+		return configuration, fmt.Errorf("error reading environment, %s", err)
+	}
+	configuration.defaults(v)
+	if err := bindEnv(v, "", reflect.TypeOf(configuration)); err != nil {
+		return configuration, fmt.Errorf("error reading environment, %s", err)
 	}
-	if err := configuration.validate(); err != nil {
-		return configuration, fmt.Errorf("unable to validate config, %v", err)
+	// Every problem is reported at once, so the decoding errors do not stop the validation
+	decodeErr := decode(v, &configuration)
+	err := errors.Join(
+		decodeErr,
+		withoutPaths(configuration.validate(v), decodeErr),
+		validation.Field("sinks."+legacyInfluxDB, configuration.addLegacyInfluxDB(v)),
+	)
+	if err != nil {
+		return configuration, fmt.Errorf("unable to validate config:\n  %s", strings.ReplaceAll(err.Error(), "\n", "\n  "))
 	}
 	return configuration, nil
 }
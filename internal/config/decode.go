@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"solar-scraper/internal/validation"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorUnknownKey string = "unknown key"
+)
+
+var (
+	// invalidKeysPattern matches the mapstructure error for keys without a field
+	invalidKeysPattern = regexp.MustCompile(`^'([^']*)' has invalid keys: (.*)$`)
+	// quotedPathPattern matches the first quoted path in a mapstructure error
+	quotedPathPattern = regexp.MustCompile(`'([^']*)' ?`)
+	// mapIndexPattern matches the map index mapstructure adds to the path of named collections
+	mapIndexPattern = regexp.MustCompile(`\[([^\]]*)\]`)
+)
+
+// decode decodes the config into the settings, unknown keys and type mismatches are returned as validation errors
+func decode(v *viper.Viper, configuration *Settings) error {
+	// mapstructure leaves out map entries with an error, unknown keys are therefore collected
+	// in a second pass so the rest of such a sink or channel is still validated
+	if err := v.Unmarshal(configuration); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return err
+		}
+	}
+	err := v.Unmarshal(&Settings{}, func(config *mapstructure.DecoderConfig) {
+		config.ErrorUnused = true
+	})
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+	errs := make([]error, 0, len(decodeErr.Errors))
+	for _, message := range decodeErr.Errors {
+		errs = append(errs, decodeError(message)...)
+	}
+	return errors.Join(errs...)
+}
+
+// decodeError converts a mapstructure error message to errors with the path of the setting
+func decodeError(message string) []error {
+	if match := invalidKeysPattern.FindStringSubmatch(message); match != nil {
+		keys := strings.Split(match[2], ", ")
+		errs := make([]error, len(keys))
+		for i, key := range keys {
+			errs[i] = validation.New(settingPath(join(match[1], key)), ErrorUnknownKey)
+		}
+		return errs
+	}
+	if match := quotedPathPattern.FindStringSubmatchIndex(message); match != nil {
+		setting := message[match[2]:match[3]]
+		return []error{validation.New(settingPath(setting), message[:match[0]]+message[match[1]:])}
+	}
+	return []error{errors.New(message)}
+}
+
+// settingPath converts a mapstructure path like sinks[name].type to sinks.name.type
+func settingPath(mapstructurePath string) string {
+	return mapIndexPattern.ReplaceAllString(mapstructurePath, ".$1")
+}
+
+// withoutPaths removes the validation errors of the settings that could not be decoded,
+// as their zero value would be reported a second time
+func withoutPaths(err error, decodeErr error) error {
+	decoded := map[string]bool{}
+	for _, e := range unjoin(decodeErr) {
+		var fieldErr *validation.Error
+		if errors.As(e, &fieldErr) {
+			decoded[fieldErr.Path] = true
+		}
+	}
+	var errs []error
+	for _, e := range unjoin(err) {
+		var fieldErr *validation.Error
+		if errors.As(e, &fieldErr) && decoded[fieldErr.Path] {
+			continue
+		}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
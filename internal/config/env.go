@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables that override the settings
+	envPrefix string = "SOLAR"
+	// fileSuffix is the suffix of the environment variables that contain the path of a file with the value
+	fileSuffix string = "_FILE"
+)
+
+// envName returns the environment variable for the setting, e.g. influxdb.v2.auth_token becomes SOLAR_INFLUXDB_V2_AUTH_TOKEN
+func envName(setting string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(setting))
+}
+
+// bindEnv binds every setting of the struct type to its environment variable.
+// The entries of named collections are bound when they exist in the config file or were added by addEnvEntries.
+// The values of other maps, like the headers of a webhook, are bound by key, only keys of the config file can be overridden.
+// A setting is taken from, in order of precedence, its environment variable,
+// the file its _FILE environment variable points to, the config file and the default.
+func bindEnv(v *viper.Viper, setting string, t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			if err := bindEnv(v, join(setting, name), field.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		names := make([]string, 0)
+		for name := range v.GetStringMap(setting) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := bindEnv(v, join(setting, name), t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return bindValue(v, setting)
+}
+
+// addEnvEntries adds the entries of named collections that only exist in the environment to the config,
+// e.g. SOLAR_SINKS_BACKUP_TYPE adds the sink backup. They are added empty, so they get their defaults and are bound like the entries of the file.
+// The name of such an entry is in lower case, a variable of an entry of the file refers to that entry.
+func addEnvEntries(v *viper.Viper, setting string, t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := fieldName(t.Field(i)); ok {
+				if err := addEnvEntries(v, join(setting, name), t.Field(i).Type); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Map:
+		if t.Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		existing := map[string]bool{}
+		for name := range v.GetStringMap(setting) {
+			existing[envName(join(setting, name))] = true
+		}
+		entries := map[string]interface{}{}
+		for _, name := range envEntries(setting, t.Elem()) {
+			if !existing[envName(join(setting, name))] {
+				entries[name] = map[string]interface{}{}
+			}
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		// MergeConfigMap merges into the config file, setting the entries would hide the entries of the file
+		parts := strings.Split(setting, ".")
+		var config interface{} = entries
+		for i := len(parts) - 1; i >= 0; i-- {
+			config = map[string]interface{}{parts[i]: config}
+		}
+		return v.MergeConfigMap(config.(map[string]interface{}))
+	}
+	return nil
+}
+
+// envEntries returns the names of the entries of the collection that have an environment variable set.
+// The name is the part of the variable between the collection and the longest setting of an entry it ends with.
+func envEntries(setting string, t reflect.Type) []string {
+	prefix := envName(setting) + "_"
+	suffixes := make([]string, 0)
+	for _, leaf := range leaves("", t) {
+		suffixes = append(suffixes, strings.TrimPrefix(envName(leaf), envPrefix))
+	}
+	// The longest suffix is tried first, so a setting of a nested struct is not taken as part of the name
+	sort.Slice(suffixes, func(i, j int) bool { return len(suffixes[i]) > len(suffixes[j]) })
+	found := map[string]bool{}
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		name = strings.TrimSuffix(name, fileSuffix)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(name, suffix) && len(name) > len(prefix)+len(suffix) {
+				found[strings.ToLower(name[len(prefix):len(name)-len(suffix)])] = true
+				break
+			}
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// leaves returns the settings of the struct type that hold a value, maps are left out as their keys are not known
+func leaves(setting string, t reflect.Type) []string {
+	switch t.Kind() {
+	case reflect.Struct:
+		settings := make([]string, 0)
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := fieldName(t.Field(i)); ok {
+				settings = append(settings, leaves(join(setting, name), t.Field(i).Type)...)
+			}
+		}
+		return settings
+	case reflect.Map:
+		return nil
+	}
+	return []string{setting}
+}
+
+// bindValue binds a single setting to its environment variable and reads its _FILE variant
+func bindValue(v *viper.Viper, setting string) error {
+	name := envName(setting)
+	if err := v.BindEnv(setting, name); err != nil {
+		return err
+	}
+	if _, ok := os.LookupEnv(name); ok {
+		return nil
+	}
+	path, ok := os.LookupEnv(name + fileSuffix)
+	if !ok {
+		return nil
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s, %s", name+fileSuffix, err)
+	}
+	// Secret files usually end with a newline, which is never part of the value
+	v.Set(setting, strings.TrimRight(string(value), "\r\n"))
+	return nil
+}
+
+// fieldName returns the name of the setting decoded into the field, false when the field is not decoded
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get("mapstructure")
+	if tag == "-" {
+		return "", false
+	}
+	if tag == "" {
+		// mapstructure matches untagged fields by their name
+		return strings.ToLower(field.Name), true
+	}
+	return tag, true
+}
+
+func join(setting, key string) string {
+	if setting == "" {
+		return key
+	}
+	return setting + "." + key
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the value of secrets in the printed config
+const redacted string = "<redacted>"
+
+// secretTag marks a setting as secret with secret:"true", for a map every value is secret
+const secretTag string = "secret"
+
+// Print writes the effective settings as YAML, secrets and passwords in urls are redacted
+func (s Settings) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	settings := tree(reflect.ValueOf(s), false).(map[string]interface{})
+	// The top level influxdb settings are already part of the sinks, printing them again would show a zero or duplicate block
+	delete(settings, legacyInfluxDB)
+	if err := encoder.Encode(settings); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// tree converts the value to nested maps keyed by the setting names, secret values are redacted
+func tree(value reflect.Value, secret bool) interface{} {
+	switch value.Kind() {
+	case reflect.Struct:
+		settings := map[string]interface{}{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if name, ok := fieldName(field); ok {
+				settings[name] = tree(value.Field(i), field.Tag.Get(secretTag) == "true")
+			}
+		}
+		return settings
+	case reflect.Map:
+		settings := map[string]interface{}{}
+		for _, key := range value.MapKeys() {
+			settings[key.String()] = tree(value.MapIndex(key), secret)
+		}
+		return settings
+	case reflect.String:
+		if value.String() != "" && secret {
+			return redacted
+		}
+		return redactURL(value.String())
+	}
+	return value.Interface()
+}
+
+// redactURL redacts the password of a url, other values are returned unchanged
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	u.User = url.UserPassword(u.User.Username(), redacted)
+	// url.String escapes the brackets of the placeholder
+	escaped := url.UserPassword(u.User.Username(), redacted).String()
+	return strings.Replace(u.String(), escaped, u.User.Username()+":"+redacted, 1)
+}
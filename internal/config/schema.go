@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// schemaID is the JSON Schema version of the generated schema
+const schemaID string = "https://json-schema.org/draft/2020-12/schema"
+
+// schema is a JSON Schema, only the keywords used for the settings are supported
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false or the schema of the values
+	Items                *schema            `json:"items,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+}
+
+// Schema returns the JSON Schema of the config file, for the validation and autocompletion in editors
+func Schema() ([]byte, error) {
+	root := schemaOf(reflect.TypeOf(Settings{}))
+	root.Schema = schemaID
+	root.Title = "solar-scraper config"
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func schemaOf(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &schema{Type: "object", Properties: map[string]*schema{}, AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := fieldName(t.Field(i)); ok {
+				s.Properties[name] = schemaOf(t.Field(i).Type)
+			}
+		}
+		return s
+	case reflect.Map:
+		// Named collections and headers, the keys are chosen by the user
+		return &schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Slice:
+		return &schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := 0
+		return &schema{Type: "integer", Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	}
+	return &schema{Type: "string"}
+}
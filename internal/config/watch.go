@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher reloads the config file on every change until it is closed
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// Close stops watching, it returns once a running reload is finished
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+// Watch reloads the config file on every change. The previous and the new settings are passed to apply,
+// when the new settings are invalid or apply returns an error the change is rejected and the previous settings stay active.
+func Watch(configPath string, current Settings, apply func(previous, next Settings) error, logger *slog.Logger) (*Watcher, error) {
+	// Resolve the path the same way as Get
+	var err error
+	if configPath == "" {
+		if configPath, err = find("."); err != nil {
+			return nil, err
+		}
+	}
+	configFile, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	// Kubernetes mounts the file as a symlink into a directory that is swapped on every update,
+	// such an update is only noticed by the changed target of the symlink
+	realConfigFile, _ := filepath.EvalSymlinks(configFile)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// The directory is watched as editors and Kubernetes replace the file instead of writing it
+	if err = watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	w := &Watcher{watcher: watcher, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentConfigFile, _ := filepath.EvalSymlinks(configFile)
+				written := filepath.Clean(event.Name) == configFile && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create))
+				swapped := currentConfigFile != "" && currentConfigFile != realConfigFile
+				if !written && !swapped {
+					continue
+				}
+				realConfigFile = currentConfigFile
+				next, err := Get(configFile)
+				if err != nil {
+					logger.Error("config change rejected", "error", err)
+					continue
+				}
+				changes := diff(current, next)
+				if len(changes) == 0 {
+					continue
+				}
+				if err = apply(current, next); err != nil {
+					logger.Error("config change rejected", "error", err)
+					continue
+				}
+				for _, change := range changes {
+					logger.Info("config changed", "change", change)
+				}
+				current = next
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("watching config failed", "error", err)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// unset is shown for a setting that is missing before or after a change
+const unset string = "<unset>"
+
+// diff returns the changed settings as "path: old -> new", ordered by path. Secrets are redacted the same way as by Print,
+// a changed secret is still reported so the change is applied.
+func diff(previous, next Settings) []string {
+	before, shownBefore := map[string]string{}, map[string]string{}
+	after, shownAfter := map[string]string{}, map[string]string{}
+	flatten("", reflect.ValueOf(previous), false, before, shownBefore)
+	flatten("", reflect.ValueOf(next), false, after, shownAfter)
+	for setting := range after {
+		if _, ok := before[setting]; !ok {
+			before[setting], shownBefore[setting] = unset, unset
+		}
+	}
+	changes := make([]string, 0)
+	for setting, old := range before {
+		updated, ok := after[setting]
+		if !ok {
+			updated, shownAfter[setting] = unset, unset
+		}
+		if old == updated {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", setting, shownBefore[setting], shownAfter[setting]))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// flatten adds every exported setting of the value to settings by its path, shown gets the value redacted like by Print
+func flatten(setting string, value reflect.Value, secret bool, settings, shown map[string]string) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if name, ok := fieldName(field); ok {
+				flatten(join(setting, name), value.Field(i), field.Tag.Get(secretTag) == "true", settings, shown)
+			}
+		}
+		return
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			flatten(join(setting, key.String()), value.MapIndex(key), secret, settings, shown)
+		}
+		return
+	}
+	settings[setting] = fmt.Sprint(value.Interface())
+	shown[setting] = fmt.Sprint(tree(value, secret))
+}
@@ -0,0 +1,132 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/rotate"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyPath     string = "empty path"
+	ErrorInvalidFormat string = "invalid format, expected csv or jsonl"
+)
+
+// Supported file formats
+const (
+	FormatCSV   string = "csv"
+	FormatJSONL string = "jsonl"
+)
+
+const csvHeader string = "timestamp,now,today,total,substituted\n"
+
+// Settings is the configuration for the file sink
+type Settings struct {
+	Format string          `mapstructure:"format"`
+	Path   string          `mapstructure:"path"`
+	Rotate rotate.Settings `mapstructure:"rotate"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".format", FormatCSV)
+	s.Rotate.Defaults(v, setting+".rotate")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Path == "" {
+		errs = append(errs, validation.New("path", ErrorEmptyPath))
+	}
+	if s.Format != FormatCSV && s.Format != FormatJSONL {
+		errs = append(errs, validation.New("format", ErrorInvalidFormat))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter opens the file and returns the writer
+func (s Settings) CreateWriter() (*Writer, error) {
+	var header []byte
+	if s.Format == FormatCSV {
+		header = []byte(csvHeader)
+	}
+	file, err := rotate.Open(s.Path, s.Rotate, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{format: s.Format, file: file}, nil
+}
+
+// Writer is a MetricsWriter that appends every reading to a file
+type Writer struct {
+	format string
+	mutex  sync.Mutex
+	file   *rotate.File
+}
+
+// Ping always succeeds, errors with the file are reported when writing
+func (w *Writer) Ping() error {
+	return nil
+}
+
+// Write appends the metrics to the file
+func (w *Writer) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var line []byte
+	if w.format == FormatJSONL {
+		line = formatJSONL(metrics, reportTime)
+	} else {
+		line = formatCSV(metrics, reportTime)
+	}
+	_, err := w.file.Write(line)
+	return err
+}
+
+// Close closes the file
+func (w *Writer) Close() error {
+	return w.file.Close()
+}
+
+func formatCSV(metrics influx.SolarMetrics, reportTime time.Time) []byte {
+	line := reportTime.Format(time.RFC3339) + ","
+	if !metrics.NowNil {
+		line += strconv.FormatUint(uint64(metrics.Now), 10)
+	}
+	return []byte(line + "," +
+		strconv.FormatFloat(metrics.Today, 'f', -1, 64) + "," +
+		strconv.FormatFloat(metrics.Total, 'f', -1, 64) + "," +
+		strconv.FormatBool(metrics.NowNil) + "\n")
+}
+
+// record is a single line of a JSON-lines file
+type record struct {
+	Timestamp   string  `json:"timestamp"`
+	Now         *uint   `json:"now"`
+	Today       float64 `json:"today"`
+	Total       float64 `json:"total"`
+	Substituted bool    `json:"substituted"`
+}
+
+func formatJSONL(metrics influx.SolarMetrics, reportTime time.Time) []byte {
+	r := record{
+		Timestamp:   reportTime.Format(time.RFC3339),
+		Today:       metrics.Today,
+		Total:       metrics.Total,
+		Substituted: metrics.NowNil,
+	}
+	if !metrics.NowNil {
+		r.Now = &metrics.Now
+	}
+	// Marshalling a struct of basic types can not fail
+	line, _ := json.Marshal(r)
+	return append(line, '\n')
+}
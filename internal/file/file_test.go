@@ -0,0 +1,84 @@
+package file
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Writer_Write(t *testing.T) {
+	reportTime := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	input := []influx.SolarMetrics{
+		{Now: 150, Today: 3.1, Total: 4756.2},
+		{NowNil: true, Today: 3.1, Total: 4756.2},
+	}
+	tests := []struct {
+		name   string
+		format string
+		output string
+	}{
+		{name: "CSV",
+			format: FormatCSV,
+			output: `timestamp,now,today,total,substituted
+2023-06-01T12:00:00Z,150,3.1,4756.2,false
+2023-06-01T12:00:00Z,,3.1,4756.2,true
+`,
+		},
+		{name: "JSONL",
+			format: FormatJSONL,
+			output: `{"timestamp":"2023-06-01T12:00:00Z","now":150,"today":3.1,"total":4756.2,"substituted":false}
+{"timestamp":"2023-06-01T12:00:00Z","now":null,"today":3.1,"total":4756.2,"substituted":true}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			path := filepath.Join(t.TempDir(), "readings")
+			writer, err := Settings{Format: test.format, Path: path}.CreateWriter()
+			require.NoError(t, err, test.name)
+			for _, metrics := range input {
+				require.NoError(t, writer.Write(metrics, reportTime, slog.New(slog.NewTextHandler(io.Discard, nil))), test.name)
+			}
+			require.NoError(t, writer.Close(), test.name)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.output, string(data), test.name)
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Settings
+		output string
+	}{
+		{name: "Valid",
+			input: Settings{Format: FormatCSV, Path: "readings.csv"},
+		},
+		{name: "ErrorEmptyPath",
+			input:  Settings{Format: FormatCSV},
+			output: "path: " + ErrorEmptyPath,
+		},
+		{name: "ErrorInvalidFormat",
+			input:  Settings{Format: "xml", Path: "readings.xml"},
+			output: "format: " + ErrorInvalidFormat,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
@@ -7,22 +7,44 @@ import (
 )
 
 const (
-	configDefault      string = ""
-	configDescription  string = "Config file path."
-	debugDefault       bool   = false
-	debugDescription   string = "Debug logging."
-	helpDefault        bool   = false
-	helpDescription    string = "Show help."
-	logDefault         string = ""
-	logDescription     string = "Log file path."
-	versionDefault     bool   = false
-	versionDescription string = "Show package version."
+	configDefault        string = ""
+	configDescription    string = "Config file path."
+	debugDefault         bool   = false
+	debugDescription     string = "Debug logging."
+	helpDefault          bool   = false
+	helpDescription      string = "Show help."
+	logDefault           string = ""
+	logDescription       string = "Log file path, overrides log.file."
+	logFormatDefault     string = ""
+	logFormatDescription string = "Log format, text or json, overrides log.format."
+	logLevelDefault      string = ""
+	logLevelDescription  string = "Log level, debug, info, warn or error, overrides log.level."
+	logOutputDefault     string = ""
+	logOutputDescription string = "Log output, stderr, file, syslog or journald, overrides log.output."
+	versionDefault       bool   = false
+	versionDescription   string = "Show package version."
+)
+
+// Commands, run is used when no command is given
+const (
+	CommandBackfill    string = "backfill"
+	CommandOnce        string = "once"
+	CommandPing        string = "ping"
+	CommandPrintConfig string = "print-config"
+	CommandReplay      string = "replay"
+	CommandReport      string = "report"
+	CommandRun         string = "run"
+	CommandSchema      string = "schema"
+	CommandValidate    string = "validate"
 )
 
 var config = flag.String("config", configDefault, configDescription)
 var debug = flag.Bool("debug", debugDefault, debugDescription)
 var help = flag.Bool("help", helpDefault, helpDescription)
 var log = flag.String("log", logDefault, logDescription)
+var logFormat = flag.String("log-format", logFormatDefault, logFormatDescription)
+var logLevel = flag.String("log-level", logLevelDefault, logLevelDescription)
+var logOutput = flag.String("log-output", logOutputDefault, logOutputDescription)
 var versionFlag = flag.Bool("version", versionDefault, versionDescription)
 
 func init() {
@@ -34,13 +56,29 @@ func init() {
 }
 
 func usage() {
-	fmt.Println("Usage: solar-scraper [options]")
+	fmt.Println("Usage: solar-scraper [options] [command]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("run\t\t\t\tScrape the inverter in the polling window and write to the sinks, the default.")
+	fmt.Println("once [-write]\t\t\tScrape the inverter once and print the reading, -write also writes it to the sinks.")
+	fmt.Println("ping\t\t\t\tCheck if the inverter and the sinks are reachable.")
+	fmt.Println("validate\t\t\tCheck the config, exits non-zero when it is invalid.")
+	fmt.Println("print-config\t\t\tPrint the effective config, including defaults and environment variables, with secrets redacted.")
+	fmt.Println("report daily|monthly [sink]\tPrint the yield per day or month from a sqlite sink.")
+	fmt.Println("backfill [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-sinks a,b] file")
+	fmt.Println("\t\t\t\tWrite the readings of a csv, json or jsonl file to the sinks, skipping readings already stored.")
+	fmt.Println("replay [-write] [-sinks a,b] directory")
+	fmt.Println("\t\t\t\tPrint the readings of the responses recorded with scraper.record, -write writes them to the sinks.")
+	fmt.Println("schema\t\t\t\tPrint the JSON Schema of the config file.")
 	fmt.Println()
 	fmt.Println("Options:")
 	println("c", "config", configDescription)
 	println("d", "debug", debugDescription)
 	println("h", "help", helpDescription)
 	println("l", "log", logDescription)
+	fmt.Println("--log-format\t\t" + logFormatDescription)
+	fmt.Println("--log-level\t\t" + logLevelDescription)
+	fmt.Println("--log-output\t\t" + logOutputDescription)
 }
 
 func println(shortFlag, longFlag, Description string) {
@@ -59,16 +97,30 @@ func Parse(version string) Options {
 		fmt.Println(version)
 		os.Exit(0)
 	}
-	return Options{
-		Config: *config,
-		Debug:  *debug,
-		Log:    *log,
+	options := Options{
+		Command:   CommandRun,
+		Config:    *config,
+		Debug:     *debug,
+		Log:       *log,
+		LogFormat: *logFormat,
+		LogLevel:  *logLevel,
+		LogOutput: *logOutput,
+	}
+	if args := flag.Args(); len(args) > 0 {
+		options.Command = args[0]
+		options.Args = args[1:]
 	}
+	return options
 }
 
 // Options is the command line options
 type Options struct {
-	Config string
-	Debug  bool
-	Log    string
+	Args      []string // Arguments of the command
+	Command   string
+	Config    string
+	Debug     bool // Overrides the log level with debug
+	Log       string
+	LogFormat string
+	LogLevel  string
+	LogOutput string
 }
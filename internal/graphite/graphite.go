@@ -0,0 +1,161 @@
+package graphite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyAddress   string = "empty address"
+	ErrorInvalidNetwork string = "invalid protocol, expected tcp or udp"
+)
+
+const (
+	now   string = "current_power"
+	today string = "yield_today"
+	total string = "total_yield"
+)
+
+// Settings is the configuration for the Graphite plaintext protocol
+type Settings struct {
+	Address  string      `mapstructure:"address"`
+	Prefix   string      `mapstructure:"prefix"` // Metric path prefix, {host} is replaced by the host tag
+	Protocol string      `mapstructure:"protocol"`
+	Tags     influx.Tags `mapstructure:"tags"`
+	Timeout  uint        `mapstructure:"timeout"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".address", "localhost:2003")
+	v.SetDefault(setting+".protocol", "tcp")
+	defaults(v, setting)
+}
+
+// StatsDSettings is the configuration for StatsD gauges
+type StatsDSettings Settings
+
+// Defaults sets the default values for the settings
+func (s StatsDSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".address", "localhost:8125")
+	v.SetDefault(setting+".protocol", "udp")
+	defaults(v, setting)
+}
+
+func defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".prefix", "solar.{host}")
+	influx.Tags{}.Defaults(v, setting+".tags")
+	v.SetDefault(setting+".timeout", 5)
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Address == "" {
+		errs = append(errs, validation.New("address", ErrorEmptyAddress))
+	}
+	if s.Protocol != "tcp" && s.Protocol != "udp" {
+		errs = append(errs, validation.New("protocol", ErrorInvalidNetwork))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks if the settings are valid
+func (s StatsDSettings) Validate() error {
+	return Settings(s).Validate()
+}
+
+// CreateWriter creates a writer for the Graphite plaintext protocol
+func (s Settings) CreateWriter() *Writer {
+	return &Writer{settings: s, format: formatGraphite}
+}
+
+// CreateWriter creates a writer for StatsD gauges
+func (s StatsDSettings) CreateWriter() *Writer {
+	return &Writer{settings: Settings(s), format: formatStatsD}
+}
+
+// Writer is a MetricsWriter that sends the metrics as lines over TCP or UDP
+type Writer struct {
+	settings Settings
+	format   func(path string, value float64, reportTime time.Time) string
+}
+
+// Ping checks if a connection can be made, for UDP this only checks if the address resolves
+func (w *Writer) Ping() error {
+	conn, err := w.dial()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Write sends the metrics
+func (w *Writer) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	conn, err := w.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Duration(w.settings.Timeout) * time.Second))
+	_, err = conn.Write(w.lines(metrics, reportTime))
+	return err
+}
+
+func (w *Writer) dial() (net.Conn, error) {
+	return net.DialTimeout(w.settings.Protocol, w.settings.Address, time.Duration(w.settings.Timeout)*time.Second)
+}
+
+// lines returns all the metrics in the configured format, a substituted current power is not sent
+func (w *Writer) lines(metrics influx.SolarMetrics, reportTime time.Time) []byte {
+	prefix := metricPrefix(w.settings.Prefix, w.settings.Tags)
+	var buffer bytes.Buffer
+	if !metrics.NowNil {
+		buffer.WriteString(w.format(prefix+now, float64(metrics.Now), reportTime))
+	}
+	buffer.WriteString(w.format(prefix+today, metrics.Today, reportTime))
+	buffer.WriteString(w.format(prefix+total, metrics.Total, reportTime))
+	return buffer.Bytes()
+}
+
+func formatGraphite(path string, value float64, reportTime time.Time) string {
+	return fmt.Sprintf("%s %s %d\n", path, formatValue(value), reportTime.Unix())
+}
+
+func formatStatsD(path string, value float64, reportTime time.Time) string {
+	return fmt.Sprintf("%s:%s|g\n", path, formatValue(value))
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// metricPrefix replaces the tags in the prefix and makes sure it ends with a dot
+func metricPrefix(prefix string, tags influx.Tags) string {
+	prefix = strings.ReplaceAll(prefix, "{host}", sanitize(tags.Host))
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return prefix
+}
+
+// sanitize replaces the characters that have a special meaning in a metric path
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', ':', '|', '@', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
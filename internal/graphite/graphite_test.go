@@ -0,0 +1,120 @@
+package graphite
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_metricPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		output string
+	}{
+		{name: "Host",
+			prefix: "solar.{host}",
+			output: "solar.my-host_local.",
+		},
+		{name: "Trailing dot",
+			prefix: "solar.",
+			output: "solar.",
+		},
+		{name: "Empty",
+			output: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			require.Equal(t, test.output, metricPrefix(test.prefix, influx.Tags{Host: "my-host.local"}), test.name)
+		})
+	}
+}
+
+func Test_Writer_Write(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reportTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		protocol string
+		statsD   bool
+		input    influx.SolarMetrics
+		output   string
+	}{
+		{name: "Graphite TCP",
+			protocol: "tcp",
+			input:    influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2},
+			output:   "solar.my-host.current_power 150 1700000000\nsolar.my-host.yield_today 3.1 1700000000\nsolar.my-host.total_yield 4756.2 1700000000\n",
+		},
+		{name: "Graphite UDP substituted",
+			protocol: "udp",
+			input:    influx.SolarMetrics{NowNil: true, Today: 3.1, Total: 4756.2},
+			output:   "solar.my-host.yield_today 3.1 1700000000\nsolar.my-host.total_yield 4756.2 1700000000\n",
+		},
+		{name: "StatsD UDP",
+			protocol: "udp",
+			statsD:   true,
+			input:    influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2},
+			output:   "solar.my-host.current_power:150|g\nsolar.my-host.yield_today:3.1|g\nsolar.my-host.total_yield:4756.2|g\n",
+		},
+		{name: "StatsD TCP",
+			protocol: "tcp",
+			statsD:   true,
+			input:    influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2},
+			output:   "solar.my-host.current_power:150|g\nsolar.my-host.yield_today:3.1|g\nsolar.my-host.total_yield:4756.2|g\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			address, received := listen(t, test.protocol)
+			settings := Settings{Address: address, Prefix: "solar.{host}", Protocol: test.protocol, Tags: influx.Tags{Host: "my-host"}, Timeout: 5}
+			var writer *Writer
+			if test.statsD {
+				writer = StatsDSettings(settings).CreateWriter()
+			} else {
+				writer = settings.CreateWriter()
+			}
+			require.NoError(t, writer.Write(test.input, reportTime, discard), test.name)
+			select {
+			case data := <-received:
+				require.Equal(t, test.output, data, test.name)
+			case <-time.After(5 * time.Second):
+				t.Fatal("nothing received")
+			}
+		})
+	}
+}
+
+// listen starts a local listener and returns its address and a channel with the first received data
+func listen(t *testing.T, protocol string) (string, chan string) {
+	received := make(chan string, 1)
+	if protocol == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		go func() {
+			buffer := make([]byte, 1024)
+			n, _, _ := conn.ReadFrom(buffer)
+			received <- string(buffer[:n])
+		}()
+		return conn.LocalAddr().String(), received
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+	return listener.Addr().String(), received
+}
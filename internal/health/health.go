@@ -0,0 +1,279 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyListen    string = "empty listen address"
+	ErrorReadyMaxAge    string = "ready max age must be greater than 0"
+	ErrorNoRecentScrape string = "no successful scrape within the ready max age"
+)
+
+// serverTimeout limits reading a request and writing its response
+const serverTimeout = 10 * time.Second
+
+// Settings is the configuration for the health and status HTTP server
+type Settings struct {
+	Enabled              bool                    `mapstructure:"enabled"`
+	Instrumentation      InstrumentationSettings `mapstructure:"instrumentation"`
+	Listen               string                  `mapstructure:"listen"`
+	ReadyMaxAgeInSeconds uint                    `mapstructure:"ready_max_age"` // Maximum age of the last successful scrape inside the polling window to be ready
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".enabled", false)
+	s.Instrumentation.Defaults(v, setting+".instrumentation")
+	v.SetDefault(setting+".listen", ":8080")
+	v.SetDefault(setting+".ready_max_age", uint(300))
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	var errs []error
+	if s.Listen == "" {
+		errs = append(errs, validation.New("listen", ErrorEmptyListen))
+	}
+	if s.ReadyMaxAgeInSeconds == 0 {
+		errs = append(errs, validation.New("ready_max_age", ErrorReadyMaxAge))
+	}
+	return errors.Join(errs...)
+}
+
+// Serve starts the HTTP server in the background when it is enabled, the server is nil when it is disabled
+func (s Settings) Serve(tracker *Tracker) (*Server, error) {
+	if !s.Enabled {
+		return nil, nil
+	}
+	listener, err := net.Listen("tcp", s.Listen)
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{server: &http.Server{
+		Handler: tracker.Handler(),
+		// A slow or stalled client must not keep a connection open forever
+		ReadHeaderTimeout: serverTimeout,
+		ReadTimeout:       serverTimeout,
+		WriteTimeout:      serverTimeout,
+	}}
+	go func() {
+		err := server.server.Serve(listener)
+		server.mutex.Lock()
+		server.serveErr = err
+		server.mutex.Unlock()
+	}()
+	return server, nil
+}
+
+// Server is the running health and status HTTP server
+type Server struct {
+	server   *http.Server
+	mutex    sync.Mutex
+	serveErr error
+}
+
+// Ping checks if the server is still running
+func (s *Server) Ping() error {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.serveErr
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// Tracker keeps track of the state of the scheduler
+type Tracker struct {
+	mutex            sync.Mutex
+	ping             func() error
+	readyMaxAge      time.Duration
+	now              func() time.Time
+	state            state
+	instrumentation  *instrumentation
+	instrumentationS InstrumentationSettings
+}
+
+// status is the response of the /status endpoint
+type status struct {
+	state
+	Instrumentation Counters `json:"instrumentation"`
+}
+
+// state is the state of the scheduler
+type state struct {
+	LastReading          *reading   `json:"last_reading"`
+	LastError            *lastError `json:"last_error"`
+	ErrorCount           uint       `json:"error_count"` // Consecutive failed scrapes
+	Substituting         bool       `json:"substituting"`
+	LastSuccessfulScrape *time.Time `json:"last_successful_scrape"`
+	Window               window     `json:"window"`
+	NextRun              time.Time  `json:"next_run"`
+}
+
+type reading struct {
+	Time        time.Time `json:"time"`
+	Now         *uint     `json:"now"`
+	Today       float64   `json:"today"`
+	Total       float64   `json:"total"`
+	Substituted bool      `json:"substituted"`
+}
+
+type lastError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// NewTracker creates a tracker, ping is used to check if the writer is reachable
+func (s Settings) NewTracker(ping func() error) *Tracker {
+	return &Tracker{
+		ping:             ping,
+		readyMaxAge:      time.Duration(s.ReadyMaxAgeInSeconds) * time.Second,
+		now:              time.Now,
+		instrumentation:  newInstrumentation(),
+		instrumentationS: s.Instrumentation,
+	}
+}
+
+// SetWindow sets the current or upcoming polling window
+func (t *Tracker) SetWindow(start, end time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.state.Window = window{Start: start, End: end}
+}
+
+// SetNextRun sets the time of the next scrape
+func (t *Tracker) SetNextRun(next time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.state.NextRun = next
+}
+
+// ObserveScrape records the result of a scrape, attempts includes the retries
+func (t *Tracker) ObserveScrape(err error, scrapeTime time.Time, latency time.Duration, attempts uint) {
+	t.instrumentation.observeScrape(latency, attempts, err)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err != nil {
+		t.state.LastError = &lastError{Time: scrapeTime, Message: err.Error()}
+		t.state.ErrorCount++
+		return
+	}
+	t.state.LastSuccessfulScrape = &scrapeTime
+	t.state.ErrorCount = 0
+}
+
+// ObserveWrite records the metrics that were written
+func (t *Tracker) ObserveWrite(metrics influx.SolarMetrics, reportTime time.Time, err error) {
+	if metrics.NowNil {
+		t.instrumentation.observeSubstituted()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.state.Substituting = metrics.NowNil
+	t.state.LastReading = &reading{
+		Time:        reportTime,
+		Today:       metrics.Today,
+		Total:       metrics.Total,
+		Substituted: metrics.NowNil,
+	}
+	if !metrics.NowNil {
+		t.state.LastReading.Now = &metrics.Now
+	}
+	if err != nil {
+		t.state.LastError = &lastError{Time: t.now(), Message: err.Error()}
+	}
+}
+
+// ObserveDropped records a point that was not written because the sustained errors limit was exceeded
+func (t *Tracker) ObserveDropped() {
+	t.instrumentation.observeDropped()
+}
+
+// ObserveSinkWrite records the duration and result of a write to a single sink
+func (t *Tracker) ObserveSinkWrite(name string, latency time.Duration, err error) {
+	t.instrumentation.observeSinkWrite(name, latency, err)
+}
+
+// WriteInstrumentation writes the counters to the writer when enabled and supported by the writer
+func (t *Tracker) WriteInstrumentation(writer influx.MetricsWriter, pointTime time.Time) error {
+	pointWriter, ok := writer.(influx.PointWriter)
+	if !t.instrumentationS.InfluxDB || !ok {
+		return nil
+	}
+	return pointWriter.WritePoint(t.instrumentationS.Measurement, t.instrumentation.snapshot().fields(), pointTime)
+}
+
+// Handler returns the handler for the /healthz, /readyz and /status endpoints
+func (t *Tracker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := t.ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		counters := t.instrumentation.snapshot()
+		t.mutex.Lock()
+		data, err := json.Marshal(status{state: t.state, Instrumentation: counters})
+		t.mutex.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+	return mux
+}
+
+// ready checks if the writer is reachable and, inside the polling window, a scrape succeeded recently
+func (t *Tracker) ready() error {
+	if err := t.ping(); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	if now.Before(t.state.Window.Start) || now.After(t.state.Window.End) {
+		return nil
+	}
+	since := t.state.Window.Start
+	if t.state.LastSuccessfulScrape != nil && t.state.LastSuccessfulScrape.After(since) {
+		since = *t.state.LastSuccessfulScrape
+	}
+	if now.Sub(since) > t.readyMaxAge {
+		return errors.New(ErrorNoRecentScrape)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"solar-scraper/internal/influx"
+	"strings"
+	"testing"
+	"time"
+
+	influxdb1 "github.com/influxdata/influxdb1-client/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func get(tracker *Tracker, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func Test_Settings_Serve(t *testing.T) {
+	tracker := Settings{ReadyMaxAgeInSeconds: 300}.NewTracker(func() error { return nil })
+	server, err := Settings{Enabled: false}.Serve(tracker)
+	require.NoError(t, err)
+	require.Nil(t, server)
+	require.NoError(t, server.Ping())
+	require.NoError(t, server.Close())
+
+	server, err = Settings{Enabled: true, Listen: "127.0.0.1:0"}.Serve(tracker)
+	require.NoError(t, err)
+	require.NoError(t, server.Ping())
+	require.NoError(t, server.Close())
+	// The error of the stopped server is reported by Ping
+	require.Eventually(t, func() bool { return server.Ping() != nil }, time.Second, 10*time.Millisecond)
+}
+
+func Test_Tracker_readyz(t *testing.T) {
+	start := time.Date(2023, 6, 1, 6, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 6, 1, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		ping    error
+		now     time.Time
+		success *time.Time
+		status  int
+	}{
+		{name: "Ready recent scrape",
+			now:     start.Add(time.Hour),
+			success: func() *time.Time { t := start.Add(time.Hour - time.Minute); return &t }(),
+			status:  http.StatusOK,
+		},
+		{name: "Ready window just started",
+			now:    start.Add(time.Minute),
+			status: http.StatusOK,
+		},
+		{name: "Ready outside window",
+			now:    end.Add(time.Hour),
+			status: http.StatusOK,
+		},
+		{name: "Not ready old scrape",
+			now:     start.Add(time.Hour),
+			success: func() *time.Time { t := start.Add(time.Minute); return &t }(),
+			status:  http.StatusServiceUnavailable,
+		},
+		{name: "Not ready writer unreachable",
+			ping:   errors.New("test error"),
+			now:    end.Add(time.Hour),
+			status: http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			tracker := Settings{ReadyMaxAgeInSeconds: 300}.NewTracker(func() error { return test.ping })
+			tracker.now = func() time.Time { return test.now }
+			tracker.SetWindow(start, end)
+			if test.success != nil {
+				tracker.ObserveScrape(nil, *test.success, time.Second, 1)
+			}
+			require.Equal(t, test.status, get(tracker, "/readyz").Code, test.name)
+			require.Equal(t, http.StatusOK, get(tracker, "/healthz").Code, test.name)
+		})
+	}
+}
+
+func Test_Tracker_status(t *testing.T) {
+	start := time.Date(2023, 6, 1, 6, 0, 0, 0, time.UTC)
+	tracker := Settings{ReadyMaxAgeInSeconds: 300}.NewTracker(func() error { return nil })
+	tracker.SetWindow(start, start.Add(16*time.Hour))
+	tracker.SetNextRun(start.Add(2 * time.Minute))
+	tracker.ObserveScrape(nil, start, time.Second, 1)
+	tracker.ObserveWrite(influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2}, start, nil)
+	tracker.ObserveScrape(errors.New("test error"), start.Add(time.Minute), 3*time.Second, 3)
+	tracker.ObserveWrite(influx.SolarMetrics{NowNil: true, Today: 3.1, Total: 4756.2}, start.Add(time.Minute), nil)
+
+	recorder := get(tracker, "/status")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Contains(t, response, "instrumentation")
+	delete(response, "instrumentation")
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"last_reading": {"time": "2023-06-01T06:01:00Z", "now": null, "today": 3.1, "total": 4756.2, "substituted": true},
+		"last_error": {"time": "2023-06-01T06:01:00Z", "message": "test error"},
+		"error_count": 1,
+		"substituting": true,
+		"last_successful_scrape": "2023-06-01T06:00:00Z",
+		"window": {"start": "2023-06-01T06:00:00Z", "end": "2023-06-01T22:00:00Z"},
+		"next_run": "2023-06-01T06:02:00Z"
+	}`, string(data))
+}
+
+func Test_Tracker_instrumentation(t *testing.T) {
+	tracker := Settings{}.NewTracker(func() error { return nil })
+	now := time.Now()
+	tracker.ObserveScrape(nil, now, 200*time.Millisecond, 1)
+	tracker.ObserveScrape(errors.New("test error"), now, 2*time.Second, 3)
+	tracker.ObserveScrape(nil, now, 700*time.Millisecond, 2)
+	tracker.ObserveWrite(influx.SolarMetrics{NowNil: true}, now, nil)
+	tracker.ObserveDropped()
+	tracker.ObserveSinkWrite("a", 100*time.Millisecond, nil)
+	tracker.ObserveSinkWrite("a", 20*time.Second, errors.New("test error"))
+
+	var response status
+	require.NoError(t, json.Unmarshal(get(tracker, "/status").Body.Bytes(), &response))
+	counters := response.Instrumentation
+	require.Equal(t, uint64(3), counters.ScrapesAttempted)
+	require.Equal(t, uint64(1), counters.ScrapesFailed)
+	require.Equal(t, uint64(3), counters.RetriesUsed)
+	require.Equal(t, uint64(1), counters.SubstitutedWritten)
+	require.Equal(t, uint64(1), counters.Dropped)
+	require.Equal(t, uint64(3), counters.ScrapeLatency.Count)
+	require.InDelta(t, 2.9, counters.ScrapeLatency.Sum, 0.0001)
+	require.Equal(t, uint64(0), counters.ScrapeLatency.Buckets["0.1"])
+	require.Equal(t, uint64(1), counters.ScrapeLatency.Buckets["0.25"])
+	require.Equal(t, uint64(2), counters.ScrapeLatency.Buckets["1"])
+	require.Equal(t, uint64(3), counters.ScrapeLatency.Buckets["2.5"])
+	require.Equal(t, uint64(3), counters.ScrapeLatency.Buckets["+Inf"])
+	require.Equal(t, uint64(2), counters.Sinks["a"].Writes)
+	require.Equal(t, uint64(1), counters.Sinks["a"].Failures)
+	require.Equal(t, uint64(1), counters.Sinks["a"].Latency.Buckets["10"])
+	require.Equal(t, uint64(2), counters.Sinks["a"].Latency.Buckets["+Inf"])
+}
+
+type pointWriter struct {
+	measurement string
+	fields      map[string]interface{}
+}
+
+func (w *pointWriter) Ping() error {
+	return nil
+}
+
+func (w *pointWriter) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	return nil
+}
+
+func (w *pointWriter) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error {
+	w.measurement = measurement
+	w.fields = fields
+	return nil
+}
+
+func Test_Tracker_WriteInstrumentation(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "Enabled", enabled: true},
+		{name: "Disabled"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			tracker := Settings{Instrumentation: InstrumentationSettings{InfluxDB: test.enabled, Measurement: "SolarScraper"}}.NewTracker(func() error { return nil })
+			tracker.ObserveScrape(nil, time.Now(), time.Second, 2)
+			tracker.ObserveSinkWrite("a", time.Second, nil)
+			writer := &pointWriter{}
+			require.NoError(t, tracker.WriteInstrumentation(writer, time.Now()), test.name)
+			if !test.enabled {
+				require.Nil(t, writer.fields, test.name)
+				return
+			}
+			require.Equal(t, "SolarScraper", writer.measurement, test.name)
+			require.Equal(t, int64(1), writer.fields["ScrapesAttempted"], test.name)
+			require.Equal(t, int64(1), writer.fields["RetriesUsed"], test.name)
+			require.Equal(t, int64(1), writer.fields["Sink_a_Writes"], test.name)
+		})
+	}
+}
+
+func Test_Counters_fields_LineProtocolV1(t *testing.T) {
+	tracker := Settings{}.NewTracker(func() error { return nil })
+	tracker.ObserveScrape(nil, time.Now(), time.Second, 2)
+	tracker.ObserveSinkWrite("a", time.Second, nil)
+	point, err := influxdb1.NewPoint("SolarScraper", nil, tracker.instrumentation.snapshot().fields(), time.Unix(0, 0))
+	require.NoError(t, err)
+	line := point.String()
+	// InfluxDB v1 rejects the unsigned integers with the u suffix
+	for _, field := range strings.Split(strings.Fields(line)[1], ",") {
+		require.False(t, strings.HasSuffix(field, "u"), field)
+	}
+	require.Contains(t, line, "ScrapesAttempted=1i")
+	require.Contains(t, line, "Sink_a_Writes=1i")
+}
@@ -0,0 +1,169 @@
+package health
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// latencyBuckets are the upper bounds in seconds of the latency histograms
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// InstrumentationSettings is the configuration for writing the instrumentation to InfluxDB
+type InstrumentationSettings struct {
+	InfluxDB    bool   `mapstructure:"influxdb"` // Write the counters to every influxdb sink after every scrape
+	Measurement string `mapstructure:"measurement"`
+}
+
+// Defaults sets the default values for the settings
+func (s InstrumentationSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".influxdb", false)
+	v.SetDefault(setting+".measurement", "SolarScraper")
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	Buckets map[string]uint64 `json:"buckets"` // Cumulative count by upper bound in seconds
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"` // Sum of all observations in seconds
+}
+
+func newHistogram() Histogram {
+	buckets := make(map[string]uint64, len(latencyBuckets)+1)
+	for _, bound := range latencyBuckets {
+		buckets[formatBound(bound)] = 0
+	}
+	buckets["+Inf"] = 0
+	return Histogram{Buckets: buckets}
+}
+
+func (h *Histogram) observe(duration time.Duration) {
+	seconds := duration.Seconds()
+	for _, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.Buckets[formatBound(bound)]++
+		}
+	}
+	h.Buckets["+Inf"]++
+	h.Count++
+	h.Sum += seconds
+}
+
+func (h Histogram) copy() Histogram {
+	buckets := make(map[string]uint64, len(h.Buckets))
+	for bound, count := range h.Buckets {
+		buckets[bound] = count
+	}
+	h.Buckets = buckets
+	return h
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+// SinkCounters are the counters of a single sink
+type SinkCounters struct {
+	Writes   uint64    `json:"writes"`
+	Failures uint64    `json:"failures"`
+	Latency  Histogram `json:"latency"`
+}
+
+// Counters are the operational counters of the scraper process
+type Counters struct {
+	ScrapesAttempted   uint64                  `json:"scrapes_attempted"`
+	ScrapesFailed      uint64                  `json:"scrapes_failed"`
+	RetriesUsed        uint64                  `json:"retries_used"`
+	ScrapeLatency      Histogram               `json:"scrape_latency"`
+	SubstitutedWritten uint64                  `json:"substituted_written"`
+	Dropped            uint64                  `json:"dropped"` // Points not written because of the sustained errors limit
+	Sinks              map[string]SinkCounters `json:"sinks"`
+}
+
+type instrumentation struct {
+	mutex    sync.Mutex
+	counters Counters
+}
+
+func newInstrumentation() *instrumentation {
+	return &instrumentation{counters: Counters{
+		ScrapeLatency: newHistogram(),
+		Sinks:         map[string]SinkCounters{},
+	}}
+}
+
+func (i *instrumentation) observeScrape(latency time.Duration, attempts uint, err error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.counters.ScrapesAttempted++
+	if err != nil {
+		i.counters.ScrapesFailed++
+	}
+	if attempts > 1 {
+		i.counters.RetriesUsed += uint64(attempts - 1)
+	}
+	i.counters.ScrapeLatency.observe(latency)
+}
+
+func (i *instrumentation) observeSubstituted() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.counters.SubstitutedWritten++
+}
+
+func (i *instrumentation) observeDropped() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.counters.Dropped++
+}
+
+func (i *instrumentation) observeSinkWrite(name string, latency time.Duration, err error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	counters, ok := i.counters.Sinks[name]
+	if !ok {
+		counters.Latency = newHistogram()
+	}
+	counters.Writes++
+	if err != nil {
+		counters.Failures++
+	}
+	counters.Latency.observe(latency)
+	i.counters.Sinks[name] = counters
+}
+
+// snapshot returns a deep copy of the counters
+func (i *instrumentation) snapshot() Counters {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	counters := i.counters
+	counters.ScrapeLatency = counters.ScrapeLatency.copy()
+	counters.Sinks = make(map[string]SinkCounters, len(i.counters.Sinks))
+	for name, sink := range i.counters.Sinks {
+		sink.Latency = sink.Latency.copy()
+		counters.Sinks[name] = sink
+	}
+	return counters
+}
+
+// fields returns the counters as InfluxDB fields, as signed integers as InfluxDB v1 does not accept unsigned ones
+func (c Counters) fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"ScrapesAttempted":   int64(c.ScrapesAttempted),
+		"ScrapesFailed":      int64(c.ScrapesFailed),
+		"RetriesUsed":        int64(c.RetriesUsed),
+		"ScrapeLatencyCount": int64(c.ScrapeLatency.Count),
+		"ScrapeLatencySum":   c.ScrapeLatency.Sum,
+		"SubstitutedWritten": int64(c.SubstitutedWritten),
+		"Dropped":            int64(c.Dropped),
+	}
+	for name, sink := range c.Sinks {
+		fields["Sink_"+name+"_Writes"] = int64(sink.Writes)
+		fields["Sink_"+name+"_Failures"] = int64(sink.Failures)
+		fields["Sink_"+name+"_LatencyCount"] = int64(sink.Latency.Count)
+		fields["Sink_"+name+"_LatencySum"] = sink.Latency.Sum
+	}
+	return fields
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
@@ -15,18 +19,33 @@ import (
 	"github.com/spf13/viper"
 )
 
-func debugMetrics(metrics SolarMetrics, reportTime time.Time, debug *log.Logger) {
+func debugMetrics(metrics SolarMetrics, reportTime time.Time, logger *slog.Logger) {
 	if metrics.NowNil {
-		debug.Printf("Time: %s, YieldToday: %f, TotalYield: %f \n", reportTime.Format("20060102150405"), metrics.Today, metrics.Total)
+		logger.Debug("writing metrics", "report_time", reportTime, today, metrics.Today, total, metrics.Total)
 	} else {
-		debug.Printf("Time: %s, CurrentPower: %d, YieldToday: %f, TotalYield: %f \n", reportTime.Format("20060102150405"), metrics.Now, metrics.Today, metrics.Total)
+		logger.Debug("writing metrics", "report_time", reportTime, now, metrics.Now, today, metrics.Today, total, metrics.Total)
 	}
 }
 
 // MetricsWriter is the interface for writing metrics to InfluxDB
 type MetricsWriter interface {
-	Ping() error                                                               // Ping checks if the InfluxDB is reachable
-	Write(metrics SolarMetrics, reportTime time.Time, debug *log.Logger) error // Write writes the metrics to InfluxDB
+	Ping() error                                                                 // Ping checks if the InfluxDB is reachable
+	Write(metrics SolarMetrics, reportTime time.Time, logger *slog.Logger) error // Write writes the metrics to InfluxDB
+}
+
+// PointWriter is implemented by writers that can write points to a separate measurement
+type PointWriter interface {
+	WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error // WritePoint writes a single point with the host tag
+}
+
+// ScrapeObserver is implemented by writers that want to be informed about every scrape, including the failed ones
+type ScrapeObserver interface {
+	ObserveScrape(err error, scrapeTime time.Time) // ObserveScrape is called after every scrape of the inverter
+}
+
+// PointChecker is implemented by writers that can tell if metrics were already written, used to skip them when backfilling
+type PointChecker interface {
+	HasPoint(reportTime time.Time) (bool, error) // HasPoint checks if metrics with the report time are stored
 }
 
 // SolarMetrics is the metrics to be written to InfluxDB
@@ -35,6 +54,18 @@ type SolarMetrics struct {
 	NowNil bool
 	Today  float64
 	Total  float64
+	Alarm  string // Alarm reported by the inverter, not written to InfluxDB
+}
+
+func metricsFields(metrics SolarMetrics) map[string]interface{} {
+	fields := map[string]interface{}{
+		today: metrics.Today,
+		total: metrics.Total,
+	}
+	if !metrics.NowNil {
+		fields[now] = metrics.Now
+	}
+	return fields
 }
 
 const (
@@ -93,35 +124,28 @@ func (s Settings) CreateWriter() MetricsWriter {
 }
 
 // Defaults sets the default values for the settings
-func (s Settings) Defaults(setting string) {
-	viper.SetDefault(setting+".retry", 2)
-	viper.SetDefault(setting+".insecure_skip_verify", false)
-	viper.SetDefault(setting+".timeout", 5)
-	// Ignore the error, at worst the default will be empty
-	hostname, _ := os.Hostname()
-	viper.SetDefault(setting+".tags.host", hostname)
-
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".retry", 2)
+	v.SetDefault(setting+".insecure_skip_verify", false)
+	v.SetDefault(setting+".timeout", 5)
+	s.Tags.Defaults(v, setting+".tags")
 }
 
 // Validate checks if the settings are valid
 func (s Settings) Validate() error {
-	if s.Version != 1 && s.Version != 2 {
-		return errors.New(ErrorInvalidVersion)
-	}
+	var errs []error
 	if s.Url == "" {
-		return errors.New(ErrorEmptyUrl)
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
 	}
 	switch s.Version {
 	case v1:
-		if err := s.V1.validate(); err != nil {
-			return err
-		}
+		errs = append(errs, validation.Field("v1", s.V1.validate()))
 	case v2:
-		if err := s.V2.validate(); err != nil {
-			return err
-		}
+		errs = append(errs, validation.Field("v2", s.V2.validate()))
+	default:
+		errs = append(errs, validation.New("version", ErrorInvalidVersion))
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // Tags for InfluxDB
@@ -129,10 +153,17 @@ type Tags struct {
 	Host string `yml:"host"`
 }
 
+// Defaults sets the hostname of the machine as the default host
+func (t Tags) Defaults(v *viper.Viper, setting string) {
+	// Ignore the error, at worst the default will be empty
+	hostname, _ := os.Hostname()
+	v.SetDefault(setting+".host", hostname)
+}
+
 // SettingsV1 is the configuration for the InfluxDB v1
 type SettingsV1 struct {
 	Database           string `mapstructure:"database"`
-	Password           string `mapstructure:"password"`
+	Password           string `mapstructure:"password" secret:"true"`
 	Username           string `mapstructure:"username"`
 	url                string
 	insecureSkipVerify bool
@@ -163,18 +194,24 @@ func (s SettingsV1) Ping() error {
 }
 
 func (s SettingsV1) validate() error {
+	var errs []error
 	if s.Database == "" {
-		return errors.New(ErrorV1EmptyDatabase)
+		errs = append(errs, validation.New("database", ErrorV1EmptyDatabase))
 	}
 	if s.Username == "" {
-		return errors.New(ErrorV1EmptyUsername)
+		errs = append(errs, validation.New("username", ErrorV1EmptyUsername))
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // Write writes the metrics to InfluxDB
-func (s SettingsV1) Write(metrics SolarMetrics, reportTime time.Time, debug *log.Logger) error {
-	debugMetrics(metrics, reportTime, debug)
+func (s SettingsV1) Write(metrics SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	debugMetrics(metrics, reportTime, logger)
+	return s.WritePoint(measurement, metricsFields(metrics), reportTime)
+}
+
+// WritePoint writes a single point with the host tag to InfluxDB
+func (s SettingsV1) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error {
 	client, err := s.newClient()
 	if err != nil {
 		return errors.New("Error creating InfluxDB Client: " + err.Error())
@@ -189,14 +226,7 @@ func (s SettingsV1) Write(metrics SolarMetrics, reportTime time.Time, debug *log
 		return err
 	}
 
-	fields := map[string]interface{}{
-		today: metrics.Today,
-		total: metrics.Total,
-	}
-	if !metrics.NowNil {
-		fields[now] = metrics.Now
-	}
-	pt, err := influxdb1.NewPoint(measurement, map[string]string{tagHost: s.tags.Host}, fields, reportTime)
+	pt, err := influxdb1.NewPoint(measurement, map[string]string{tagHost: s.tags.Host}, fields, pointTime)
 	if err != nil {
 		return err
 	}
@@ -211,11 +241,30 @@ func (s SettingsV1) Write(metrics SolarMetrics, reportTime time.Time, debug *log
 	return client.Close()
 }
 
+// HasPoint checks if metrics with the report time are stored for the host, the points are written with second precision
+func (s SettingsV1) HasPoint(reportTime time.Time) (bool, error) {
+	client, err := s.newClient()
+	if err != nil {
+		return false, errors.New("Error creating InfluxDB Client: " + err.Error())
+	}
+	defer client.Close()
+	query := fmt.Sprintf(`SELECT count(%q) FROM %q WHERE %q = '%s' AND time = %d`,
+		total, measurement, tagHost, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s.tags.Host), reportTime.Truncate(time.Second).UnixNano())
+	response, err := client.Query(influxdb1.NewQuery(query, s.Database, ""))
+	if err != nil {
+		return false, err
+	}
+	if err = response.Error(); err != nil {
+		return false, err
+	}
+	return len(response.Results) > 0 && len(response.Results[0].Series) > 0, nil
+}
+
 // SettingsV2 is the configuration for the InfluxDB v2
 type SettingsV2 struct {
 	Organization       string `mapstructure:"org"`
 	Bucket             string `mapstructure:"bucket"`
-	AuthToken          string `mapstructure:"auth_token"`
+	AuthToken          string `mapstructure:"auth_token" secret:"true"`
 	url                string
 	insecureSkipVerify bool
 	tags               Tags
@@ -234,30 +283,51 @@ func (s SettingsV2) Ping() error {
 }
 
 func (s SettingsV2) validate() error {
+	var errs []error
 	if s.Organization == "" {
-		return errors.New(ErrorV2EmptyOrg)
+		errs = append(errs, validation.New("org", ErrorV2EmptyOrg))
 	}
 	if s.Bucket == "" {
-		return errors.New(ErrorV2EmptyBucket)
+		errs = append(errs, validation.New("bucket", ErrorV2EmptyBucket))
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // Write writes the metrics to InfluxDB
-func (s SettingsV2) Write(metrics SolarMetrics, reportTime time.Time, debug *log.Logger) (err error) {
-	debugMetrics(metrics, reportTime, debug)
+func (s SettingsV2) Write(metrics SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	debugMetrics(metrics, reportTime, logger)
+	return s.WritePoint(measurement, metricsFields(metrics), reportTime)
+}
+
+// HasPoint checks if metrics with the report time are stored for the host
+func (s SettingsV2) HasPoint(reportTime time.Time) (bool, error) {
 	client := influxdb2.NewClient(s.url, s.AuthToken)
 	defer client.Close()
 	client.Options().SetTLSConfig(&tls.Config{InsecureSkipVerify: s.insecureSkipVerify})
-	writeAPI := client.WriteAPIBlocking(s.Organization, s.Bucket)
-	p := influxdb2.NewPointWithMeasurement(measurement).
-		AddTag(tagHost, s.tags.Host).
-		AddField(today, metrics.Today).
-		AddField(total, metrics.Total).
-		SetTime(reportTime)
-	if !metrics.NowNil {
-		p.AddField(now, metrics.Now)
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => r._measurement == %s and r.%s == %s and r._field == %s)
+  |> limit(n: 1)`,
+		strconv.Quote(s.Bucket), reportTime.UTC().Format(time.RFC3339Nano), reportTime.Add(time.Nanosecond).UTC().Format(time.RFC3339Nano),
+		strconv.Quote(measurement), tagHost, strconv.Quote(s.tags.Host), strconv.Quote(total))
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	result, err := client.QueryAPI(s.Organization).Query(ctx, query)
+	if err != nil {
+		return false, err
 	}
+	defer result.Close()
+	found := result.Next()
+	return found, result.Err()
+}
+
+// WritePoint writes a single point with the host tag to InfluxDB
+func (s SettingsV2) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) (err error) {
+	client := influxdb2.NewClient(s.url, s.AuthToken)
+	defer client.Close()
+	client.Options().SetTLSConfig(&tls.Config{InsecureSkipVerify: s.insecureSkipVerify})
+	writeAPI := client.WriteAPIBlocking(s.Organization, s.Bucket)
+	p := influxdb2.NewPoint(measurement, map[string]string{tagHost: s.tags.Host}, fields, pointTime)
 	for i := -1; i < int(s.retry); i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 		err = writeAPI.WritePoint(ctx, p)
@@ -0,0 +1,50 @@
+package influx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SettingsV1_HasPoint(t *testing.T) {
+	stored := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.FormValue("q")
+		queries = append(queries, query)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(query, "time = "+strconv.FormatInt(stored.UnixNano(), 10)) {
+			_, _ = w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"PowerYield","columns":["time","count"],"values":[[0,1]]}]}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}))
+	defer server.Close()
+	writer := Settings{Version: v1, Url: server.URL, Timeout: 5, Tags: Tags{Host: "o'host"}, V1: SettingsV1{Database: "solar", Username: "user"}}.CreateWriter()
+	checker, ok := writer.(PointChecker)
+	require.True(t, ok)
+
+	// Points are written with second precision
+	has, err := checker.HasPoint(stored.Add(300 * time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = checker.HasPoint(stored.Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, has)
+	require.Equal(t, `SELECT count("TotalYield") FROM "PowerYield" WHERE "Host" = 'o\'host' AND time = `+strconv.FormatInt(stored.UnixNano(), 10), queries[0])
+}
+
+func Test_Tags_Defaults(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	v := viper.New()
+	Tags{}.Defaults(v, "sinks.local.influxdb.tags")
+	require.Equal(t, hostname, v.GetString("sinks.local.influxdb.tags.host"))
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Severities of RFC 5424, also used as journald priorities
+const (
+	severityError   int = 3
+	severityWarning int = 4
+	severityInfo    int = 6
+	severityDebug   int = 7
+)
+
+// sender delivers a formatted record to a log destination that keeps the time and the severity itself
+type sender interface {
+	send(severity int, recordTime time.Time, message []byte) error
+	Close() error
+}
+
+// severity maps the level to the RFC 5424 severity
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return severityError
+	case level >= slog.LevelWarn:
+		return severityWarning
+	case level >= slog.LevelInfo:
+		return severityInfo
+	}
+	return severityDebug
+}
+
+// sendingState is shared by a handler and the handlers derived from it with attributes or groups
+type sendingState struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	sender sender
+}
+
+// sendingHandler formats the record with the wrapped handler and passes it to the sender
+type sendingHandler struct {
+	slog.Handler
+	state *sendingState
+}
+
+// newSendingHandler creates a handler that leaves out the time and the level, the sender transports them
+func newSendingHandler(sender sender, format string, level slog.Level) (*sendingHandler, error) {
+	state := &sendingState{sender: sender}
+	handler, err := newHandler(&state.buffer, format, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sendingHandler{Handler: handler, state: state}, nil
+}
+
+// Handle formats the record and sends it
+func (h *sendingHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.state.mutex.Lock()
+	defer h.state.mutex.Unlock()
+	h.state.buffer.Reset()
+	if err := h.Handler.Handle(ctx, record); err != nil {
+		return err
+	}
+	return h.state.sender.send(severity(record.Level), record.Time, bytes.TrimSuffix(h.state.buffer.Bytes(), []byte("\n")))
+}
+
+// WithAttrs returns a handler with the attributes that sends to the same destination
+func (h *sendingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sendingHandler{Handler: h.Handler.WithAttrs(attrs), state: h.state}
+}
+
+// WithGroup returns a handler with the group that sends to the same destination
+func (h *sendingHandler) WithGroup(name string) slog.Handler {
+	return &sendingHandler{Handler: h.Handler.WithGroup(name), state: h.state}
+}
@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptySocket string = "empty socket"
+)
+
+// JournaldSettings is the configuration of the journald output
+type JournaldSettings struct {
+	Socket     string `mapstructure:"socket"`     // Path of the journald socket
+	Identifier string `mapstructure:"identifier"` // SYSLOG_IDENTIFIER of the entries
+}
+
+// Defaults sets the default values for the settings
+func (s JournaldSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".socket", "/run/systemd/journal/socket")
+	v.SetDefault(setting+".identifier", "solar-scraper")
+}
+
+// Validate checks if the settings are valid
+func (s JournaldSettings) Validate() error {
+	if s.Socket == "" {
+		return validation.New("socket", ErrorEmptySocket)
+	}
+	return nil
+}
+
+// journald sends entries with the native journal protocol, a datagram of KEY=VALUE lines
+type journald struct {
+	identifier string
+	conn       net.Conn
+}
+
+func dialJournald(settings JournaldSettings) (*journald, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unixgram", settings.Socket)
+	if err != nil {
+		return nil, err
+	}
+	return &journald{identifier: settings.Identifier, conn: conn}, nil
+}
+
+// send writes the entry, the time of the entry is set by journald when it is received
+func (j *journald) send(severity int, _ time.Time, message []byte) error {
+	var entry bytes.Buffer
+	writeField(&entry, "PRIORITY", []byte(strconv.Itoa(severity)))
+	writeField(&entry, "SYSLOG_IDENTIFIER", []byte(j.identifier))
+	writeField(&entry, "MESSAGE", message)
+	_, err := j.conn.Write(entry.Bytes())
+	return err
+}
+
+// writeField writes KEY=VALUE, a value with a newline is written as KEY, newline, little endian 64 bit length and the value
+func writeField(entry *bytes.Buffer, key string, value []byte) {
+	entry.WriteString(key)
+	if bytes.IndexByte(value, '\n') < 0 {
+		entry.WriteByte('=')
+		entry.Write(value)
+		entry.WriteByte('\n')
+		return
+	}
+	entry.WriteByte('\n')
+	_ = binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.Write(value)
+	entry.WriteByte('\n')
+}
+
+// Close closes the connection to the socket
+func (j *journald) Close() error {
+	return j.conn.Close()
+}
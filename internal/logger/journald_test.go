@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_New_Journald(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.socket")
+	conn, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger, err := New(Settings{
+		Output:   OutputJournald,
+		Format:   FormatText,
+		Level:    "debug",
+		Journald: JournaldSettings{Socket: socket, Identifier: "solar-scraper"},
+	})
+	require.NoError(t, err)
+	logger.Warn("restart required")
+	logger.Debug("line\nbreak")
+
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{name: "Warning",
+			entry: "PRIORITY=4\nSYSLOG_IDENTIFIER=solar-scraper\nMESSAGE=msg=\"restart required\"\n",
+		},
+		// The text handler quotes the newline, so the message stays on one line
+		{name: "Debug",
+			entry: "PRIORITY=7\nSYSLOG_IDENTIFIER=solar-scraper\nMESSAGE=msg=\"line\\nbreak\"\n",
+		},
+	}
+	buffer := make([]byte, 4096)
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)), test.name)
+			n, _, err := conn.ReadFrom(buffer)
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.entry, string(buffer[:n]), test.name)
+		})
+	}
+}
+
+func Test_writeField(t *testing.T) {
+	var entry bytes.Buffer
+	writeField(&entry, "MESSAGE", []byte("a\nb"))
+	require.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", entry.String())
+}
@@ -1,45 +1,188 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"solar-scraper/internal/rotate"
+	"solar-scraper/internal/validation"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyFile     string = "empty file"
+	ErrorInvalidFormat string = "invalid log format, expected text or json"
+	ErrorInvalidLevel  string = "invalid log level, expected debug, info, warn or error"
+	ErrorInvalidOutput string = "invalid log output, expected stderr, file, syslog or journald"
+)
+
+// Outputs of the logger, without an output the file is used when set and stderr otherwise
+const (
+	OutputFile     string = "file"
+	OutputJournald string = "journald"
+	OutputStderr   string = "stderr"
+	OutputSyslog   string = "syslog"
 )
 
-// New creates new loggers
-func New(file string, debug bool) *Loggers {
-	fileHandle := getFileHandle(file)
-	loggers := Loggers{
-		Error: newLogger("ERROR", fileHandle, os.Stderr),
+// Formats of the log output
+const (
+	FormatJSON string = "json"
+	FormatText string = "text"
+)
+
+// Settings is the configuration of the logger, the command line options override it
+type Settings struct {
+	Output   string           `mapstructure:"output"`
+	File     string           `mapstructure:"file"` // Log file path
+	Format   string           `mapstructure:"format"`
+	Level    string           `mapstructure:"level"`
+	Rotate   rotate.Settings  `mapstructure:"rotate"` // Rotation of the log file
+	Syslog   SyslogSettings   `mapstructure:"syslog"`
+	Journald JournaldSettings `mapstructure:"journald"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".file", "")
+	v.SetDefault(setting+".format", FormatText)
+	v.SetDefault(setting+".level", slog.LevelInfo.String())
+	s.Rotate.Defaults(v, setting+".rotate")
+	v.SetDefault(setting+".rotate.max_files", uint(7))
+	s.Syslog.Defaults(v, setting+".syslog")
+	s.Journald.Defaults(v, setting+".journald")
+}
+
+// output returns the output, the file is used when no output is set
+func (s Settings) output() string {
+	if s.Output != "" {
+		return s.Output
 	}
-	if debug {
-		loggers.Debug = newLogger("DEBUG", fileHandle, os.Stdout)
-	} else {
-		loggers.Debug = log.New(io.Discard, "", 0)
+	if s.File != "" {
+		return OutputFile
 	}
-	return &loggers
+	return OutputStderr
 }
 
-func getFileHandle(file string) *os.File {
-	if file != "" {
-		fileHandle, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if _, err := parseLevel(s.Level); err != nil {
+		errs = append(errs, validation.Field("level", err))
+	}
+	if _, err := newHandler(io.Discard, s.Format, nil); err != nil {
+		errs = append(errs, validation.Field("format", err))
+	}
+	switch s.output() {
+	case OutputStderr:
+	case OutputFile:
+		if s.File == "" {
+			errs = append(errs, validation.New("file", ErrorEmptyFile))
+		}
+	case OutputSyslog:
+		errs = append(errs, validation.Field("syslog", s.Syslog.Validate()))
+	case OutputJournald:
+		errs = append(errs, validation.Field("journald", s.Journald.Validate()))
+	default:
+		errs = append(errs, validation.New("output", ErrorInvalidOutput))
+	}
+	return errors.Join(errs...)
+}
+
+// New creates a structured logger writing records of the level and above to the output.
+// A log file is rotated according to the settings and reopened on SIGHUP.
+func New(settings Settings) (*slog.Logger, error) {
+	level, err := parseLevel(settings.Level)
+	if err != nil {
+		return nil, err
+	}
+	switch settings.output() {
+	case OutputStderr:
+		return newLogger(os.Stderr, settings.Format, level)
+	case OutputFile:
+		return newFileLogger(settings, level)
+	case OutputSyslog:
+		syslog, err := dialSyslog(settings.Syslog)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		return fileHandle
+		return newSendingLogger(syslog, settings.Format, level)
+	case OutputJournald:
+		journald, err := dialJournald(settings.Journald)
+		if err != nil {
+			return nil, err
+		}
+		return newSendingLogger(journald, settings.Format, level)
+	}
+	return nil, errors.New(ErrorInvalidOutput)
+}
+
+func newFileLogger(settings Settings, level slog.Level) (*slog.Logger, error) {
+	file, err := rotate.Open(settings.File, settings.Rotate, nil)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := newLogger(file, settings.Format, level)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go reopen(file, hangup)
+	return logger, nil
+}
+
+// newSendingLogger creates a logger for a destination that keeps the time and the severity itself
+func newSendingLogger(sender sender, format string, level slog.Level) (*slog.Logger, error) {
+	handler, err := newSendingHandler(sender, format, level)
+	if err != nil {
+		sender.Close()
+		return nil, err
 	}
-	return nil
+	return slog.New(handler), nil
 }
 
-func newLogger(prefix string, file *os.File, alternative *os.File) *log.Logger {
-	if file != nil {
-		return log.New(file, prefix+": ", log.Ldate|log.Ltime)
+func newLogger(output io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	handler, err := newHandler(output, format, &slog.HandlerOptions{Level: level})
+	if err != nil {
+		return nil, err
 	}
-	return log.New(alternative, prefix+": ", log.Ldate|log.Ltime)
+	return slog.New(handler), nil
 }
 
-// Loggers contains all the loggers
-type Loggers struct {
-	Debug *log.Logger
-	Error *log.Logger
+func newHandler(output io.Writer, format string, options *slog.HandlerOptions) (slog.Handler, error) {
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.NewTextHandler(output, options), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(output, options), nil
+	}
+	return nil, errors.New(ErrorInvalidFormat)
+}
+
+func parseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, errors.New(ErrorInvalidLevel)
+	}
+	return level, nil
+}
+
+// reopen reopens the file on every signal, so external tools like logrotate can move it away
+func reopen(file *rotate.File, signals <-chan os.Signal) {
+	for range signals {
+		// The log file itself might be the problem, so the error goes to stderr
+		if err := file.Reopen(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
 }
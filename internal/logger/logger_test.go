@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"solar-scraper/internal/rotate"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newLogger(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		level  string
+		output string
+		err    string
+	}{
+		{name: "Text",
+			format: FormatText,
+			level:  "info",
+			output: "level=INFO msg=written sink=file\n",
+		},
+		{name: "JSON",
+			format: FormatJSON,
+			level:  "debug",
+			output: `{"level":"INFO","msg":"written","sink":"file"}` + "\n",
+		},
+		{name: "Below level",
+			format: FormatText,
+			level:  "warn",
+		},
+		{name: "Default level",
+			format: FormatText,
+			output: "level=INFO msg=written sink=file\n",
+		},
+		{name: "ErrorInvalidLevel",
+			format: FormatText,
+			level:  "verbose",
+			err:    ErrorInvalidLevel,
+		},
+		{name: "ErrorInvalidFormat",
+			format: "xml",
+			level:  "info",
+			err:    ErrorInvalidFormat,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			var output bytes.Buffer
+			level, err := parseLevel(test.level)
+			if err == nil {
+				var logger *slog.Logger
+				if logger, err = newLogger(&output, test.format, level); err == nil {
+					logger.Info("written", "sink", "file")
+				}
+			}
+			if test.err != "" {
+				require.EqualError(t, err, test.err, test.name)
+				return
+			}
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.output, withoutTime(t, test.format, output.String()), test.name)
+		})
+	}
+}
+
+// withoutTime removes the time from the record, so it can be compared
+func withoutTime(t *testing.T, format, output string) string {
+	if output == "" {
+		return output
+	}
+	if format == FormatJSON {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(output), &record))
+		delete(record, "time")
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		return string(data) + "\n"
+	}
+	_, record, _ := bytes.Cut([]byte(output), []byte(" "))
+	return string(record)
+}
+
+func Test_New_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "solar.log")
+	logger, err := New(Settings{File: file, Format: FormatJSON, Level: "error"})
+	require.NoError(t, err)
+	logger.Warn("dropped")
+	logger.Error("kept")
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"msg":"kept"`)
+	require.NotContains(t, string(data), "dropped")
+}
+
+func Test_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "solar.log")
+	file, err := rotate.Open(path, rotate.Settings{}, nil)
+	require.NoError(t, err)
+	defer file.Close()
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		reopen(file, signals)
+		close(done)
+	}()
+	require.NoError(t, os.Rename(path, path+".1"))
+	signals <- syscall.SIGHUP
+	close(signals)
+	<-done
+	_, err = file.Write([]byte("after\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(data))
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Settings
+		output string
+	}{
+		{name: "Valid", input: Settings{Format: FormatJSON, Level: "warn"}},
+		{name: "Invalid",
+			input:  Settings{Format: "xml", Level: "verbose"},
+			output: "level: " + ErrorInvalidLevel + "\nformat: " + ErrorInvalidFormat,
+		},
+		{name: "ErrorEmptyFile",
+			input:  Settings{Output: OutputFile},
+			output: "file: " + ErrorEmptyFile,
+		},
+		{name: "ErrorInvalidOutput",
+			input:  Settings{Output: "eventlog"},
+			output: "output: " + ErrorInvalidOutput,
+		},
+		{name: "Invalid syslog",
+			input:  Settings{Output: OutputSyslog, Syslog: SyslogSettings{Network: NetworkUDP, Address: "localhost:514"}},
+			output: "syslog.facility: " + ErrorInvalidFacility,
+		},
+		{name: "Syslog settings ignored for other outputs",
+			input: Settings{File: "solar.log"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyAddress    string = "empty address"
+	ErrorInvalidNetwork  string = "invalid network, expected udp or tcp"
+	ErrorInvalidFacility string = "invalid facility"
+)
+
+// Networks of the syslog server
+const (
+	NetworkTCP string = "tcp"
+	NetworkUDP string = "udp"
+)
+
+// facilities are the RFC 5424 facility codes by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogSettings is the configuration of a remote syslog server
+type SyslogSettings struct {
+	Network  string `mapstructure:"network"` // udp or tcp
+	Address  string `mapstructure:"address"` // host:port of the server
+	Facility string `mapstructure:"facility"`
+	Tag      string `mapstructure:"tag"` // APP-NAME of the messages
+}
+
+// Defaults sets the default values for the settings
+func (s SyslogSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".network", NetworkUDP)
+	v.SetDefault(setting+".address", "localhost:514")
+	v.SetDefault(setting+".facility", "daemon")
+	v.SetDefault(setting+".tag", "solar-scraper")
+}
+
+// Validate checks if the settings are valid
+func (s SyslogSettings) Validate() error {
+	var errs []error
+	if s.Network != NetworkUDP && s.Network != NetworkTCP {
+		errs = append(errs, validation.New("network", ErrorInvalidNetwork))
+	}
+	if s.Address == "" {
+		errs = append(errs, validation.New("address", ErrorEmptyAddress))
+	}
+	if _, ok := facilities[s.Facility]; !ok {
+		errs = append(errs, validation.New("facility", ErrorInvalidFacility))
+	}
+	return errors.Join(errs...)
+}
+
+// syslog sends RFC 5424 messages, over TCP they are framed by octet counting as described in RFC 6587
+type syslog struct {
+	settings SyslogSettings
+	hostname string
+	mutex    sync.Mutex
+	conn     net.Conn
+}
+
+func dialSyslog(settings SyslogSettings) (*syslog, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslog{settings: settings, hostname: hostname}
+	if err = s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslog) dial() error {
+	conn, err := net.DialTimeout(s.settings.Network, s.settings.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslog) send(severity int, recordTime time.Time, message []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	priority := facilities[s.settings.Facility]*8 + severity
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, recordTime.Format(time.RFC3339Nano), s.hostname, s.settings.Tag, os.Getpid(), message)
+	if s.settings.Network == NetworkTCP {
+		line = strconv.Itoa(len(line)) + " " + line
+	}
+	// A TCP connection might have been closed by the server, it is dialed again once
+	var err error
+	for i := -1; i < 1; i++ {
+		if s.conn == nil {
+			if err = s.dial(); err != nil {
+				continue
+			}
+		}
+		if _, err = s.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection to the server
+func (s *syslog) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
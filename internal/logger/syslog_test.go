@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syslogStandIn listens on a local socket and passes every received message to the returned channel
+func syslogStandIn(t *testing.T, network string) (string, chan string) {
+	messages := make(chan string, 10)
+	if network == NetworkUDP {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		go func() {
+			buffer := make([]byte, 4096)
+			for {
+				n, _, err := conn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				messages <- string(buffer[:n])
+			}
+		}()
+		return conn.LocalAddr().String(), messages
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// Octet counting framing, the length is followed by a space
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				return
+			}
+			message := make([]byte, n)
+			if _, err = reader.Read(message); err != nil {
+				return
+			}
+			messages <- string(message)
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func Test_New_Syslog(t *testing.T) {
+	hostname, _ := os.Hostname()
+	prefix := func(priority int) string {
+		return "<" + strconv.Itoa(priority) + `>1 \S+ ` + regexp.QuoteMeta(hostname) + " solar-scraper " + strconv.Itoa(os.Getpid()) + " - - "
+	}
+	tests := []struct {
+		name     string
+		network  string
+		facility string
+		format   string
+		messages []string
+	}{
+		{name: "UDP",
+			network:  NetworkUDP,
+			facility: "daemon",
+			format:   FormatText,
+			messages: []string{
+				prefix(3*8+6) + `msg="config changed" sink=file$`,
+				prefix(3*8+3) + `msg="scrape failed" sink=file attempt=2$`,
+			},
+		},
+		{name: "TCP",
+			network:  NetworkTCP,
+			facility: "local0",
+			format:   FormatJSON,
+			messages: []string{
+				prefix(16*8+6) + regexp.QuoteMeta(`{"msg":"config changed","sink":"file"}`) + "$",
+				prefix(16*8+3) + regexp.QuoteMeta(`{"msg":"scrape failed","sink":"file","attempt":2}`) + "$",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			address, messages := syslogStandIn(t, test.network)
+			logger, err := New(Settings{
+				Output: OutputSyslog,
+				Format: test.format,
+				Level:  "info",
+				Syslog: SyslogSettings{Network: test.network, Address: address, Facility: test.facility, Tag: "solar-scraper"},
+			})
+			require.NoError(t, err, test.name)
+			logger = logger.With("sink", "file")
+			logger.Info("config changed")
+			logger.Debug("below the level")
+			logger.Error("scrape failed", "attempt", 2)
+			for _, expected := range test.messages {
+				select {
+				case message := <-messages:
+					require.Regexp(t, expected, message, test.name)
+				case <-time.After(5 * time.Second):
+					t.Fatal("no message received")
+				}
+			}
+		})
+	}
+}
+
+func Test_SyslogSettings_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  SyslogSettings
+		output string
+	}{
+		{name: "Valid", input: SyslogSettings{Network: NetworkTCP, Address: "syslog:514", Facility: "local7"}},
+		{name: "Invalid",
+			input:  SyslogSettings{Network: "unix", Facility: "local8"},
+			output: "network: " + ErrorInvalidNetwork + "\naddress: " + ErrorEmptyAddress + "\nfacility: " + ErrorInvalidFacility,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyUrl       string = "empty url"
+	ErrorEmptyTopic     string = "empty topic"
+	ErrorInvalidQoS     string = "qos must be 0, 1 or 2"
+	ErrorEmptyDiscovery string = "empty discovery prefix"
+	ErrorNotConnected   string = "not connected to the MQTT broker"
+	ErrorPublishTimeout string = "timeout publishing to the MQTT broker"
+)
+
+const stateTopic string = "/state"
+
+// Settings is the configuration for the MQTT publisher
+type Settings struct {
+	ClientID  string            `mapstructure:"client_id"`
+	Discovery DiscoverySettings `mapstructure:"discovery"`
+	Password  string            `mapstructure:"password" secret:"true"`
+	QoS       byte              `mapstructure:"qos"`
+	Retain    bool              `mapstructure:"retain"`
+	Tags      influx.Tags       `mapstructure:"tags"`
+	Timeout   uint              `mapstructure:"timeout"`
+	Topic     string            `mapstructure:"topic"`
+	Url       string            `mapstructure:"url"`
+	Username  string            `mapstructure:"username"`
+}
+
+// DiscoverySettings is the configuration for the Home Assistant MQTT discovery
+type DiscoverySettings struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Prefix  string `mapstructure:"prefix"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	// Ignore the error, at worst the default will be empty
+	hostname, _ := os.Hostname()
+	v.SetDefault(setting+".client_id", "solar-scraper-"+hostname)
+	v.SetDefault(setting+".discovery.enabled", true)
+	v.SetDefault(setting+".discovery.prefix", "homeassistant")
+	v.SetDefault(setting+".qos", 1)
+	v.SetDefault(setting+".retain", true)
+	s.Tags.Defaults(v, setting+".tags")
+	v.SetDefault(setting+".timeout", 5)
+	v.SetDefault(setting+".topic", "solar-scraper/"+hostname)
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	if s.Topic == "" {
+		errs = append(errs, validation.New("topic", ErrorEmptyTopic))
+	}
+	if s.QoS > 2 {
+		errs = append(errs, validation.New("qos", ErrorInvalidQoS))
+	}
+	if s.Discovery.Enabled && s.Discovery.Prefix == "" {
+		errs = append(errs, validation.New("discovery.prefix", ErrorEmptyDiscovery))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter creates the publisher and waits up to the timeout for the first connection to the broker,
+// when the broker is not reachable in time the connection is retried in the background until it succeeds
+func (s Settings) CreateWriter() *Publisher {
+	publisher := &Publisher{settings: s, timeout: time.Duration(s.Timeout) * time.Second}
+	options := paho.NewClientOptions().
+		AddBroker(s.Url).
+		SetClientID(s.ClientID).
+		SetUsername(s.Username).
+		SetPassword(s.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(publisher.timeout).
+		SetOnConnectHandler(publisher.onConnect)
+	publisher.client = paho.NewClient(options)
+	// The token of a retried connect only completes once connected, so the result of the wait is not an error
+	publisher.client.Connect().WaitTimeout(publisher.timeout)
+	return publisher
+}
+
+// Publisher is a MetricsWriter that publishes the metrics to an MQTT broker
+type Publisher struct {
+	settings     Settings
+	client       paho.Client
+	timeout      time.Duration
+	mutex        sync.Mutex
+	discoveryErr error
+}
+
+// onConnect publishes the discovery messages, this is done on every connect as the broker might have lost them.
+// The handler has no logger, a failure is logged by the next write and the messages are published again on the next connect.
+func (p *Publisher) onConnect(client paho.Client) {
+	if !p.settings.Discovery.Enabled {
+		return
+	}
+	var errs []error
+	for topic, payload := range discoveryMessages(p.settings) {
+		token := client.Publish(topic, p.settings.QoS, true, payload)
+		if !token.WaitTimeout(p.timeout) {
+			errs = append(errs, fmt.Errorf("%s: %s", topic, ErrorPublishTimeout))
+			continue
+		}
+		if err := token.Error(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", topic, err))
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.discoveryErr = errors.Join(errs...)
+}
+
+// logDiscoveryError logs the failure of the last discovery once
+func (p *Publisher) logDiscoveryError(logger *slog.Logger) {
+	p.mutex.Lock()
+	err := p.discoveryErr
+	p.discoveryErr = nil
+	p.mutex.Unlock()
+	if err != nil {
+		logger.Warn("publishing discovery failed", "error", err)
+	}
+}
+
+// Ping checks if the connection to the broker is open
+func (p *Publisher) Ping() error {
+	if !p.client.IsConnectionOpen() {
+		return errors.New(ErrorNotConnected)
+	}
+	return nil
+}
+
+// Close disconnects from the broker, waiting for the timeout to finish pending publishes
+func (p *Publisher) Close() error {
+	p.client.Disconnect(uint(p.timeout.Milliseconds()))
+	return nil
+}
+
+// Write publishes the metrics to the state topic
+func (p *Publisher) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	p.logDiscoveryError(logger)
+	if !p.client.IsConnectionOpen() {
+		return errors.New(ErrorNotConnected)
+	}
+	payload, err := json.Marshal(newState(metrics, reportTime))
+	if err != nil {
+		return err
+	}
+	token := p.client.Publish(p.settings.Topic+stateTopic, p.settings.QoS, p.settings.Retain, payload)
+	if !token.WaitTimeout(p.timeout) {
+		return errors.New(ErrorPublishTimeout)
+	}
+	return token.Error()
+}
+
+// state is the payload published to the state topic
+type state struct {
+	CurrentPower *uint   `json:"current_power"`
+	YieldToday   float64 `json:"yield_today"`
+	TotalYield   float64 `json:"total_yield"`
+	Timestamp    string  `json:"timestamp"`
+}
+
+func newState(metrics influx.SolarMetrics, reportTime time.Time) state {
+	s := state{
+		YieldToday: metrics.Today,
+		TotalYield: metrics.Total,
+		Timestamp:  reportTime.Format(time.RFC3339),
+	}
+	if !metrics.NowNil {
+		s.CurrentPower = &metrics.Now
+	}
+	return s
+}
+
+// discoveryConfig is the Home Assistant MQTT discovery payload for a sensor
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	DeviceClass       string          `json:"device_class"`
+	StateClass        string          `json:"state_class"`
+	UnitOfMeasurement string          `json:"unit_of_measurement"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+}
+
+type sensor struct {
+	id          string
+	name        string
+	deviceClass string
+	stateClass  string
+	unit        string
+	nullable    bool // The value is null when the inverter did not report it
+}
+
+// valueTemplate returns the template that extracts the value from the state, a null value becomes unknown in Home Assistant
+func (e sensor) valueTemplate() string {
+	if e.nullable {
+		return "{{ value_json." + e.id + " if value_json." + e.id + " is not none else 'unknown' }}"
+	}
+	return "{{ value_json." + e.id + " }}"
+}
+
+// sensors are the sensors announced to Home Assistant, compatible with the energy dashboard
+var sensors = []sensor{
+	{id: "current_power", name: "Current power", deviceClass: "power", stateClass: "measurement", unit: "W", nullable: true},
+	{id: "yield_today", name: "Yield today", deviceClass: "energy", stateClass: "total_increasing", unit: "kWh"},
+	{id: "total_yield", name: "Total yield", deviceClass: "energy", stateClass: "total_increasing", unit: "kWh"},
+}
+
+// discoveryMessages returns the discovery payloads by topic
+func discoveryMessages(s Settings) map[string][]byte {
+	nodeID := objectID(s.Tags.Host)
+	device := discoveryDevice{
+		Identifiers: []string{"solar-scraper_" + nodeID},
+		Name:        "Solar inverter " + s.Tags.Host,
+	}
+	messages := make(map[string][]byte, len(sensors))
+	for _, e := range sensors {
+		// Marshalling a struct of strings can not fail
+		payload, _ := json.Marshal(discoveryConfig{
+			Name:              e.name,
+			UniqueID:          "solar-scraper_" + nodeID + "_" + e.id,
+			StateTopic:        s.Topic + stateTopic,
+			ValueTemplate:     e.valueTemplate(),
+			DeviceClass:       e.deviceClass,
+			StateClass:        e.stateClass,
+			UnitOfMeasurement: e.unit,
+			Device:            device,
+		})
+		messages[s.Discovery.Prefix+"/sensor/"+nodeID+"/"+e.id+"/config"] = payload
+	}
+	return messages
+}
+
+// objectID replaces all characters not allowed in a Home Assistant node id
+func objectID(value string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, value)
+}
@@ -0,0 +1,176 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newState(t *testing.T) {
+	reportTime := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		input  influx.SolarMetrics
+		output string
+	}{
+		{name: "Valid",
+			input:  influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2},
+			output: `{"current_power":150,"yield_today":3.1,"total_yield":4756.2,"timestamp":"2023-06-01T12:00:00Z"}`,
+		},
+		{name: "Valid substituted",
+			input:  influx.SolarMetrics{NowNil: true, Today: 3.1, Total: 4756.2},
+			output: `{"current_power":null,"yield_today":3.1,"total_yield":4756.2,"timestamp":"2023-06-01T12:00:00Z"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			payload, err := json.Marshal(newState(test.input, reportTime))
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.output, string(payload), test.name)
+		})
+	}
+}
+
+func Test_discoveryMessages(t *testing.T) {
+	settings := Settings{
+		Discovery: DiscoverySettings{Enabled: true, Prefix: "homeassistant"},
+		Tags:      influx.Tags{Host: "my.host"},
+		Topic:     "solar-scraper/my-host",
+	}
+	messages := discoveryMessages(settings)
+	require.Len(t, messages, 3)
+	var config discoveryConfig
+	require.NoError(t, json.Unmarshal(messages["homeassistant/sensor/my_host/total_yield/config"], &config))
+	require.Equal(t, discoveryConfig{
+		Name:              "Total yield",
+		UniqueID:          "solar-scraper_my_host_total_yield",
+		StateTopic:        "solar-scraper/my-host/state",
+		ValueTemplate:     "{{ value_json.total_yield }}",
+		DeviceClass:       "energy",
+		StateClass:        "total_increasing",
+		UnitOfMeasurement: "kWh",
+		Device:            discoveryDevice{Identifiers: []string{"solar-scraper_my_host"}, Name: "Solar inverter my.host"},
+	}, config)
+	require.NoError(t, json.Unmarshal(messages["homeassistant/sensor/my_host/current_power/config"], &config))
+	require.Equal(t, "power", config.DeviceClass)
+	require.Equal(t, "measurement", config.StateClass)
+	require.Equal(t, "W", config.UnitOfMeasurement)
+	require.Equal(t, "{{ value_json.current_power if value_json.current_power is not none else 'unknown' }}", config.ValueTemplate)
+}
+
+func Test_Publisher_logDiscoveryError(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	publisher := &Publisher{discoveryErr: errors.New("not authorized")}
+	publisher.logDiscoveryError(logger)
+	require.Contains(t, output.String(), "not authorized")
+	// The failure is only logged once
+	output.Reset()
+	publisher.logDiscoveryError(logger)
+	require.Empty(t, output.String())
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Settings
+		output string
+	}{
+		{name: "Valid",
+			input: Settings{Url: "tcp://localhost:1883", Topic: "solar", Discovery: DiscoverySettings{Enabled: true, Prefix: "homeassistant"}},
+		},
+		{name: "Valid discovery disabled",
+			input: Settings{Url: "tcp://localhost:1883", Topic: "solar"},
+		},
+		{name: "ErrorEmptyUrl",
+			input:  Settings{Topic: "solar"},
+			output: "url: " + ErrorEmptyUrl,
+		},
+		{name: "ErrorEmptyTopic",
+			input:  Settings{Url: "tcp://localhost:1883"},
+			output: "topic: " + ErrorEmptyTopic,
+		},
+		{name: "ErrorInvalidQoS",
+			input:  Settings{Url: "tcp://localhost:1883", Topic: "solar", QoS: 3},
+			output: "qos: " + ErrorInvalidQoS,
+		},
+		{name: "ErrorEmptyDiscovery",
+			input:  Settings{Url: "tcp://localhost:1883", Topic: "solar", Discovery: DiscoverySettings{Enabled: true}},
+			output: "discovery.prefix: " + ErrorEmptyDiscovery,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
+
+// brokerStandIn accepts MQTT connections and acknowledges every CONNECT, other packets are ignored
+func brokerStandIn(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					packetType, err := reader.ReadByte()
+					if err != nil {
+						return
+					}
+					// The remaining length is a variable length integer
+					length, multiplier := 0, 1
+					for {
+						b, err := reader.ReadByte()
+						if err != nil {
+							return
+						}
+						length += int(b&127) * multiplier
+						multiplier *= 128
+						if b&128 == 0 {
+							break
+						}
+					}
+					if _, err = io.CopyN(io.Discard, reader, int64(length)); err != nil {
+						return
+					}
+					switch packetType >> 4 {
+					case 1: // CONNECT
+						conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+					case 12: // PINGREQ
+						conn.Write([]byte{0xd0, 0x00})
+					}
+				}
+			}()
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func Test_CreateWriter_Ping(t *testing.T) {
+	publisher := Settings{Url: brokerStandIn(t), ClientID: "test", Topic: "solar", Timeout: 5}.CreateWriter()
+	defer publisher.Close()
+	// The first connection is made before CreateWriter returns
+	require.NoError(t, publisher.Ping())
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyUrl         string = "empty url"
+	ErrorEmptyTopic       string = "empty topic"
+	ErrorEmptyToken       string = "empty token"
+	ErrorEmptyChatID      string = "empty chat id"
+	ErrorInvalidFormat    string = "invalid format, expected slack, discord or telegram"
+	ErrorInvalidPriority  string = "invalid priority"
+	ErrorUnexpectedStatus string = "unexpected status"
+)
+
+// Supported chat webhook formats
+const (
+	FormatDiscord  string = "discord"
+	FormatSlack    string = "slack"
+	FormatTelegram string = "telegram"
+)
+
+// post sends the body and checks for a 2xx response
+func post(client *http.Client, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", ErrorUnexpectedStatus, resp.Status, strings.TrimSpace(string(response)))
+	}
+	return nil
+}
+
+func postJSON(client *http.Client, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(client, url, "application/json", body, headers)
+}
+
+// NtfySettings is the configuration for an ntfy topic
+type NtfySettings struct {
+	Priority uint     `mapstructure:"priority"` // 1 (min) to 5 (max)
+	Tags     []string `mapstructure:"tags"`
+	Token    string   `mapstructure:"token" secret:"true"` // Access token, only needed for protected topics
+	Topic    string   `mapstructure:"topic"`
+	Url      string   `mapstructure:"url"`
+}
+
+// Defaults sets the default values for the settings
+func (s NtfySettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".priority", uint(4))
+	v.SetDefault(setting+".url", "https://ntfy.sh")
+}
+
+func (s NtfySettings) validate() error {
+	var errs []error
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	if s.Topic == "" {
+		errs = append(errs, validation.New("topic", ErrorEmptyTopic))
+	}
+	if s.Priority < 1 || s.Priority > 5 {
+		errs = append(errs, validation.New("priority", ErrorInvalidPriority))
+	}
+	return errors.Join(errs...)
+}
+
+type ntfy struct {
+	settings NtfySettings
+	client   *http.Client
+}
+
+func (n *ntfy) send(title, message string, notification Notification) error {
+	headers := map[string]string{
+		"Title":    title,
+		"Priority": strconv.FormatUint(uint64(n.settings.Priority), 10),
+	}
+	if len(n.settings.Tags) > 0 {
+		headers["Tags"] = strings.Join(n.settings.Tags, ",")
+	}
+	if n.settings.Token != "" {
+		headers["Authorization"] = "Bearer " + n.settings.Token
+	}
+	return post(n.client, strings.TrimSuffix(n.settings.Url, "/")+"/"+n.settings.Topic, "text/plain", []byte(message), headers)
+}
+
+// GotifySettings is the configuration for a Gotify application
+type GotifySettings struct {
+	Priority uint   `mapstructure:"priority"`
+	Token    string `mapstructure:"token" secret:"true"` // Application token
+	Url      string `mapstructure:"url"`
+}
+
+// Defaults sets the default values for the settings
+func (s GotifySettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".priority", uint(5))
+}
+
+func (s GotifySettings) validate() error {
+	var errs []error
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	if s.Token == "" {
+		errs = append(errs, validation.New("token", ErrorEmptyToken))
+	}
+	return errors.Join(errs...)
+}
+
+type gotify struct {
+	settings GotifySettings
+	client   *http.Client
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority uint   `json:"priority"`
+}
+
+func (g *gotify) send(title, message string, notification Notification) error {
+	return postJSON(g.client, strings.TrimSuffix(g.settings.Url, "/")+"/message", gotifyMessage{
+		Title:    title,
+		Message:  message,
+		Priority: g.settings.Priority,
+	}, map[string]string{"X-Gotify-Key": g.settings.Token})
+}
+
+// ChatSettings is the configuration for a Slack, Discord or Telegram compatible chat webhook
+type ChatSettings struct {
+	ChatID string `mapstructure:"chat_id"` // Only used by telegram
+	Format string `mapstructure:"format"`
+	Url    string `mapstructure:"url" secret:"true"` // Webhook url, for telegram https://api.telegram.org/bot<token>/sendMessage
+}
+
+// Defaults sets the default values for the settings
+func (s ChatSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".format", FormatSlack)
+}
+
+func (s ChatSettings) validate() error {
+	var errs []error
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	switch s.Format {
+	case FormatDiscord, FormatSlack:
+	case FormatTelegram:
+		if s.ChatID == "" {
+			errs = append(errs, validation.New("chat_id", ErrorEmptyChatID))
+		}
+	default:
+		errs = append(errs, validation.New("format", ErrorInvalidFormat))
+	}
+	return errors.Join(errs...)
+}
+
+type chat struct {
+	settings ChatSettings
+	client   *http.Client
+}
+
+func (c *chat) send(title, message string, notification Notification) error {
+	text := title + "\n" + message
+	var payload interface{}
+	switch c.settings.Format {
+	case FormatDiscord:
+		payload = map[string]string{"content": text}
+	case FormatTelegram:
+		payload = map[string]string{"chat_id": c.settings.ChatID, "text": text}
+	default:
+		payload = map[string]string{"text": text}
+	}
+	return postJSON(c.client, c.settings.Url, payload, nil)
+}
@@ -0,0 +1,276 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"solar-scraper/internal/validation"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyType   string = "empty type"
+	ErrorInvalidType string = "invalid type"
+	ErrorQueueFull   string = "notification queue full, notification dropped"
+)
+
+const (
+	// TypeChat posts the notifications to a Slack, Discord or Telegram compatible chat webhook
+	TypeChat string = "chat"
+	// TypeGotify pushes the notifications to a Gotify server
+	TypeGotify string = "gotify"
+	// TypeLog writes the notifications to the error log
+	TypeLog string = "log"
+	// TypeNtfy pushes the notifications to an ntfy topic
+	TypeNtfy string = "ntfy"
+	// TypeSMTP sends the notifications by email
+	TypeSMTP string = "smtp"
+)
+
+// Notification is an alert that started firing or was resolved
+type Notification struct {
+	Host    string
+	Rule    string
+	Firing  bool // True when the alert started firing, false when it was resolved
+	Message string
+	Time    time.Time
+}
+
+// Status returns FIRING or RESOLVED
+func (n Notification) Status() string {
+	if n.Firing {
+		return "FIRING"
+	}
+	return "RESOLVED"
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(notification Notification) error // Notify sends the notification
+}
+
+// sender delivers an already rendered notification
+type sender interface {
+	send(title, message string, notification Notification) error
+}
+
+// Settings is the configuration for a single notification channel
+type Settings struct {
+	Type    string         `mapstructure:"type"`
+	Title   string         `mapstructure:"title"`   // Go template, executed with the Notification
+	Message string         `mapstructure:"message"` // Go template, executed with the Notification
+	Timeout uint           `mapstructure:"timeout"`
+	Chat    ChatSettings   `mapstructure:"chat"`
+	Gotify  GotifySettings `mapstructure:"gotify"`
+	Ntfy    NtfySettings   `mapstructure:"ntfy"`
+	SMTP    SMTPSettings   `mapstructure:"smtp"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".title", "[{{.Status}}] {{.Rule}} on {{.Host}}")
+	v.SetDefault(setting+".message", "{{.Message}}")
+	v.SetDefault(setting+".timeout", uint(10))
+	s.Chat.Defaults(v, setting+".chat")
+	s.Gotify.Defaults(v, setting+".gotify")
+	s.Ntfy.Defaults(v, setting+".ntfy")
+	s.SMTP.Defaults(v, setting+".smtp")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if _, err := template.New("title").Parse(s.Title); err != nil {
+		errs = append(errs, validation.Field("title", err))
+	}
+	if _, err := template.New("message").Parse(s.Message); err != nil {
+		errs = append(errs, validation.Field("message", err))
+	}
+	switch s.Type {
+	case "":
+		errs = append(errs, validation.New("type", ErrorEmptyType))
+	case TypeChat:
+		errs = append(errs, validation.Field(s.Type, s.Chat.validate()))
+	case TypeGotify:
+		errs = append(errs, validation.Field(s.Type, s.Gotify.validate()))
+	case TypeLog:
+	case TypeNtfy:
+		errs = append(errs, validation.Field(s.Type, s.Ntfy.validate()))
+	case TypeSMTP:
+		errs = append(errs, validation.Field(s.Type, s.SMTP.validate()))
+	default:
+		errs = append(errs, validation.New("type", ErrorInvalidType))
+	}
+	return errors.Join(errs...)
+}
+
+func (s Settings) parseTemplates() (title *template.Template, message *template.Template, err error) {
+	if title, err = template.New("title").Parse(s.Title); err != nil {
+		return
+	}
+	message, err = template.New("message").Parse(s.Message)
+	return
+}
+
+// CreateNotifier creates a Notifier based on the type of the channel
+func (s Settings) CreateNotifier(logger *slog.Logger) (Notifier, error) {
+	title, message, err := s.parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: time.Duration(s.Timeout) * time.Second}
+	notifier := &templated{title: title, message: message}
+	switch s.Type {
+	case TypeChat:
+		notifier.sender = &chat{settings: s.Chat, client: client}
+	case TypeGotify:
+		notifier.sender = &gotify{settings: s.Gotify, client: client}
+	case TypeLog:
+		notifier.sender = &logSender{logger: logger}
+	case TypeNtfy:
+		notifier.sender = &ntfy{settings: s.Ntfy, client: client}
+	case TypeSMTP:
+		notifier.sender = &smtpSender{settings: s.SMTP, timeout: time.Duration(s.Timeout) * time.Second}
+	default:
+		return nil, errors.New(ErrorInvalidType)
+	}
+	return notifier, nil
+}
+
+// templated is a Notifier that renders the title and message before sending them
+type templated struct {
+	title   *template.Template
+	message *template.Template
+	sender  sender
+}
+
+func (t *templated) Notify(notification Notification) error {
+	var title, message bytes.Buffer
+	if err := t.title.Execute(&title, notification); err != nil {
+		return err
+	}
+	if err := t.message.Execute(&message, notification); err != nil {
+		return err
+	}
+	return t.sender.send(title.String(), message.String(), notification)
+}
+
+// Collection contains all the configured notification channels by name
+type Collection map[string]Settings
+
+// Defaults sets the default values for every channel present in the config
+func (c Collection) Defaults(v *viper.Viper, setting string) {
+	for name := range v.GetStringMap(setting) {
+		Settings{}.Defaults(v, setting+"."+name)
+	}
+}
+
+// Validate checks if all the channels are valid
+func (c Collection) Validate() error {
+	errs := make([]error, 0, len(c))
+	for _, name := range c.names() {
+		errs = append(errs, validation.Field(name, c[name].Validate()))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateNotifier creates a single Notifier that sends to every channel
+func (c Collection) CreateNotifier(logger *slog.Logger) (*Multi, error) {
+	multi := &Multi{}
+	for _, name := range c.names() {
+		notifier, err := c[name].CreateNotifier(logger.With("channel", name))
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", name, err)
+		}
+		multi.notifiers = append(multi.notifiers, namedNotifier{name: name, notifier: notifier})
+	}
+	return multi, nil
+}
+
+func (c Collection) names() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type namedNotifier struct {
+	name     string
+	notifier Notifier
+}
+
+// Multi is a Notifier that sends to multiple channels, a failing channel does not prevent the others from being notified
+type Multi struct {
+	notifiers []namedNotifier
+}
+
+// Notify sends the notification to every channel
+func (m *Multi) Notify(notification Notification) error {
+	errs := make([]error, len(m.notifiers))
+	for i, n := range m.notifiers {
+		if err := n.notifier.Notify(notification); err != nil {
+			errs[i] = fmt.Errorf("channel %s: %w", n.name, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Queue is a Notifier that sends the notifications in the background, so a slow channel does not delay the caller.
+// Notifications are sent in order, when size notifications are waiting further ones are dropped.
+type Queue struct {
+	notifications chan Notification
+	done          chan struct{}
+}
+
+// NewQueue starts sending the queued notifications to the notifier, failures are logged
+func NewQueue(notifier Notifier, size uint, logger *slog.Logger) *Queue {
+	q := &Queue{notifications: make(chan Notification, size), done: make(chan struct{})}
+	go func() {
+		defer close(q.done)
+		for notification := range q.notifications {
+			if err := notifier.Notify(notification); err != nil {
+				logger.Error("sending the notification failed", "rule", notification.Rule, "error", err)
+			}
+		}
+	}()
+	return q
+}
+
+// Notify queues the notification, it only fails when the queue is full
+func (q *Queue) Notify(notification Notification) error {
+	select {
+	case q.notifications <- notification:
+		return nil
+	default:
+		return errors.New(ErrorQueueFull)
+	}
+}
+
+// Close sends the queued notifications and stops the queue, Notify must not be called afterwards
+func (q *Queue) Close() {
+	close(q.notifications)
+	<-q.done
+}
+
+type logSender struct {
+	logger *slog.Logger
+}
+
+// send logs firing alerts as warnings and resolved alerts as info
+func (l *logSender) send(title, message string, notification Notification) error {
+	level := slog.LevelInfo
+	if notification.Firing {
+		level = slog.LevelWarn
+	}
+	l.logger.Log(context.Background(), level, title, "message", message, "rule", notification.Rule, "host", notification.Host)
+	return nil
+}
@@ -0,0 +1,409 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testNotification = Notification{
+	Host:    "my-host",
+	Rule:    "zero_production",
+	Firing:  true,
+	Message: "no production since 12:00",
+	Time:    time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC),
+}
+
+type received struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func standIn(t *testing.T, status int) (*httptest.Server, *[]received) {
+	requests := &[]received{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, received{path: r.URL.Path, header: r.Header, body: string(body)})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func defaultSettings(channelType string) Settings {
+	return Settings{
+		Type:    channelType,
+		Title:   "[{{.Status}}] {{.Rule}} on {{.Host}}",
+		Message: "{{.Message}}",
+		Timeout: 5,
+	}
+}
+
+func Test_Notify_HTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings func(url string) Settings
+		path     string
+		headers  map[string]string
+		body     string
+	}{
+		{name: "ntfy",
+			settings: func(url string) Settings {
+				s := defaultSettings(TypeNtfy)
+				s.Ntfy = NtfySettings{Url: url, Topic: "solar", Priority: 4, Tags: []string{"warning", "sun"}, Token: "tk_secret"}
+				return s
+			},
+			path:    "/solar",
+			headers: map[string]string{"Title": "[FIRING] zero_production on my-host", "Priority": "4", "Tags": "warning,sun", "Authorization": "Bearer tk_secret"},
+			body:    "no production since 12:00",
+		},
+		{name: "gotify",
+			settings: func(url string) Settings {
+				s := defaultSettings(TypeGotify)
+				s.Gotify = GotifySettings{Url: url + "/", Token: "app-token", Priority: 8}
+				return s
+			},
+			path:    "/message",
+			headers: map[string]string{"X-Gotify-Key": "app-token", "Content-Type": "application/json"},
+			body:    `{"title":"[FIRING] zero_production on my-host","message":"no production since 12:00","priority":8}`,
+		},
+		{name: "slack",
+			settings: func(url string) Settings {
+				s := defaultSettings(TypeChat)
+				s.Chat = ChatSettings{Url: url + "/hook", Format: FormatSlack}
+				return s
+			},
+			path: "/hook",
+			body: `{"text":"[FIRING] zero_production on my-host\nno production since 12:00"}`,
+		},
+		{name: "discord",
+			settings: func(url string) Settings {
+				s := defaultSettings(TypeChat)
+				s.Chat = ChatSettings{Url: url + "/hook", Format: FormatDiscord}
+				return s
+			},
+			path: "/hook",
+			body: `{"content":"[FIRING] zero_production on my-host\nno production since 12:00"}`,
+		},
+		{name: "telegram custom templates",
+			settings: func(url string) Settings {
+				s := defaultSettings(TypeChat)
+				s.Title = "{{if .Firing}}🔴{{else}}🟢{{end}} {{.Rule}}"
+				s.Message = "{{.Message}} ({{.Time.Format \"15:04\"}})"
+				s.Chat = ChatSettings{Url: url + "/botTOKEN/sendMessage", Format: FormatTelegram, ChatID: "-100123"}
+				return s
+			},
+			path: "/botTOKEN/sendMessage",
+			body: `{"chat_id":"-100123","text":"🔴 zero_production\nno production since 12:00 (12:30)"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			server, requests := standIn(t, http.StatusOK)
+			settings := test.settings(server.URL)
+			require.NoError(t, settings.Validate(), test.name)
+			notifier, err := settings.CreateNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			require.NoError(t, err, test.name)
+			require.NoError(t, notifier.Notify(testNotification), test.name)
+			require.Len(t, *requests, 1, test.name)
+			request := (*requests)[0]
+			require.Equal(t, test.path, request.path, test.name)
+			for key, value := range test.headers {
+				require.Equal(t, value, request.header.Get(key), test.name)
+			}
+			if strings.HasPrefix(test.body, "{") {
+				require.JSONEq(t, test.body, request.body, test.name)
+			} else {
+				require.Equal(t, test.body, request.body, test.name)
+			}
+		})
+	}
+}
+
+func Test_Notify_HTTP_Error(t *testing.T) {
+	server, _ := standIn(t, http.StatusUnauthorized)
+	settings := defaultSettings(TypeGotify)
+	settings.Gotify = GotifySettings{Url: server.URL, Token: "wrong"}
+	notifier, err := settings.CreateNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.ErrorContains(t, notifier.Notify(testNotification), ErrorUnexpectedStatus+" 401")
+}
+
+func Test_Notify_Log(t *testing.T) {
+	var output bytes.Buffer
+	notifier, err := defaultSettings(TypeLog).CreateNotifier(slog.New(slog.NewJSONHandler(&output, nil)))
+	require.NoError(t, err)
+	tests := []struct {
+		name         string
+		notification Notification
+		level        string
+		title        string
+	}{
+		{name: "Firing", notification: testNotification, level: "WARN", title: "[FIRING] zero_production on my-host"},
+		{name: "Resolved",
+			notification: Notification{Host: "my-host", Rule: "zero_production", Message: "production resumed"},
+			level:        "INFO",
+			title:        "[RESOLVED] zero_production on my-host",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			output.Reset()
+			require.NoError(t, notifier.Notify(test.notification), test.name)
+			var record map[string]string
+			require.NoError(t, json.Unmarshal(output.Bytes(), &record), test.name)
+			require.Equal(t, test.level, record["level"], test.name)
+			require.Equal(t, test.title, record["msg"], test.name)
+			require.Equal(t, test.notification.Message, record["message"], test.name)
+			require.Equal(t, "zero_production", record["rule"], test.name)
+			require.Equal(t, "my-host", record["host"], test.name)
+		})
+	}
+}
+
+// smtpStandIn is a minimal SMTP server that accepts a single mail without authentication
+func smtpStandIn(t *testing.T) (string, uint, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	mail := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		write := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		write("220 localhost ESMTP")
+		var transcript strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				transcript.WriteString(strings.TrimSpace(line) + "\n")
+				write("250 OK")
+			case command == "DATA":
+				write("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					data, err := reader.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					transcript.WriteString(data)
+				}
+				write("250 OK")
+			case command == "QUIT":
+				write("221 Bye")
+				mail <- transcript.String()
+				return
+			default:
+				write("502 Not implemented")
+			}
+		}
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	return "127.0.0.1", uint(address.Port), mail
+}
+
+func Test_Notify_SMTP(t *testing.T) {
+	host, port, mail := smtpStandIn(t)
+	settings := defaultSettings(TypeSMTP)
+	settings.SMTP = SMTPSettings{Host: host, Port: port, From: "solar@example.com", To: []string{"a@example.com", "b@example.com"}}
+	require.NoError(t, settings.Validate())
+	notifier, err := settings.CreateNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.NoError(t, notifier.Notify(testNotification))
+	select {
+	case transcript := <-mail:
+		require.Equal(t, "MAIL FROM:<solar@example.com>\n"+
+			"RCPT TO:<a@example.com>\n"+
+			"RCPT TO:<b@example.com>\n"+
+			"From: solar@example.com\r\n"+
+			"To: a@example.com, b@example.com\r\n"+
+			"Subject: [FIRING] zero_production on my-host\r\n"+
+			"Date: Thu, 01 Jun 2023 12:30:00 +0000\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/plain; charset=utf-8\r\n"+
+			"\r\n"+
+			"no production since 12:00\r\n", transcript)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received on port " + strconv.FormatUint(uint64(port), 10))
+	}
+}
+
+func Test_Notify_SMTP_Timeout(t *testing.T) {
+	// The server accepts the connection but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			_, _ = io.Copy(io.Discard, conn)
+		}
+	}()
+	settings := defaultSettings(TypeSMTP)
+	settings.Timeout = 1
+	settings.SMTP = SMTPSettings{Host: "127.0.0.1", Port: uint(listener.Addr().(*net.TCPAddr).Port), From: "solar@example.com", To: []string{"a@example.com"}}
+	notifier, err := settings.CreateNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	start := time.Now()
+	require.Error(t, notifier.Notify(testNotification))
+	require.Less(t, time.Since(start), 3*time.Second)
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  func() Settings
+		output string
+	}{
+		{name: "Valid log",
+			input: func() Settings { return defaultSettings(TypeLog) },
+		},
+		{name: "ErrorEmptyType",
+			input:  func() Settings { return defaultSettings("") },
+			output: "type: " + ErrorEmptyType,
+		},
+		{name: "ErrorInvalidType",
+			input:  func() Settings { return defaultSettings("pager") },
+			output: "type: " + ErrorInvalidType,
+		},
+		{name: "Error invalid template",
+			input: func() Settings {
+				s := defaultSettings(TypeLog)
+				s.Title = "{{.Rule"
+				return s
+			},
+			output: "title: template: title:1: unclosed action",
+		},
+		{name: "ErrorEmptyTopic",
+			input: func() Settings {
+				s := defaultSettings(TypeNtfy)
+				s.Ntfy = NtfySettings{Url: "https://ntfy.sh", Priority: 3}
+				return s
+			},
+			output: "ntfy.topic: " + ErrorEmptyTopic,
+		},
+		{name: "ErrorInvalidPriority",
+			input: func() Settings {
+				s := defaultSettings(TypeNtfy)
+				s.Ntfy = NtfySettings{Url: "https://ntfy.sh", Topic: "solar", Priority: 6}
+				return s
+			},
+			output: "ntfy.priority: " + ErrorInvalidPriority,
+		},
+		{name: "ErrorEmptyToken",
+			input: func() Settings {
+				s := defaultSettings(TypeGotify)
+				s.Gotify = GotifySettings{Url: "http://localhost"}
+				return s
+			},
+			output: "gotify.token: " + ErrorEmptyToken,
+		},
+		{name: "ErrorEmptyChatID",
+			input: func() Settings {
+				s := defaultSettings(TypeChat)
+				s.Chat = ChatSettings{Url: "http://localhost", Format: FormatTelegram}
+				return s
+			},
+			output: "chat.chat_id: " + ErrorEmptyChatID,
+		},
+		{name: "ErrorInvalidFormat",
+			input: func() Settings {
+				s := defaultSettings(TypeChat)
+				s.Chat = ChatSettings{Url: "http://localhost", Format: "irc"}
+				return s
+			},
+			output: "chat.format: " + ErrorInvalidFormat,
+		},
+		{name: "ErrorEmptyRecipient",
+			input: func() Settings {
+				s := defaultSettings(TypeSMTP)
+				s.SMTP = SMTPSettings{Host: "localhost", From: "solar@example.com"}
+				return s
+			},
+			output: "smtp.to: " + ErrorEmptyRecipient,
+		},
+		{name: "Multiple errors",
+			input: func() Settings {
+				s := defaultSettings(TypeSMTP)
+				s.Message = "{{.Rule"
+				s.SMTP = SMTPSettings{}
+				return s
+			},
+			output: "message: template: message:1: unclosed action\nsmtp.host: " + ErrorEmptyHost + "\nsmtp.from: " + ErrorEmptyFrom + "\nsmtp.to: " + ErrorEmptyRecipient,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input().Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
+
+func Test_Multi_Notify(t *testing.T) {
+	server, requests := standIn(t, http.StatusInternalServerError)
+	failing := defaultSettings(TypeChat)
+	failing.Chat = ChatSettings{Url: server.URL, Format: FormatSlack}
+	var output bytes.Buffer
+	multi, err := Collection{"a-chat": failing, "b-log": defaultSettings(TypeLog)}.CreateNotifier(slog.New(slog.NewTextHandler(&output, nil)))
+	require.NoError(t, err)
+	err = multi.Notify(testNotification)
+	require.ErrorContains(t, err, "channel a-chat: "+ErrorUnexpectedStatus)
+	require.Len(t, *requests, 1)
+	// The failing channel does not prevent the others from being notified
+	require.NotEmpty(t, output.String())
+}
+
+// blockingNotifier records the notifications once release is closed
+type blockingNotifier struct {
+	release       chan struct{}
+	notifications []Notification
+}
+
+func (n *blockingNotifier) Notify(notification Notification) error {
+	<-n.release
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func Test_Queue_Notify(t *testing.T) {
+	notifier := &blockingNotifier{release: make(chan struct{})}
+	queue := NewQueue(notifier, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// The first notification is taken by the sender, the second waits in the queue and the third is dropped
+	require.NoError(t, queue.Notify(Notification{Rule: "first"}))
+	require.Eventually(t, func() bool { return len(queue.notifications) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, queue.Notify(Notification{Rule: "second"}))
+	require.EqualError(t, queue.Notify(Notification{Rule: "third"}), ErrorQueueFull)
+
+	close(notifier.release)
+	queue.Close()
+	require.Equal(t, []Notification{{Rule: "first"}, {Rule: "second"}}, notifier.notifications)
+}
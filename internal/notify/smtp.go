@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyHost      string = "empty host"
+	ErrorEmptyFrom      string = "empty from address"
+	ErrorEmptyRecipient string = "no recipients"
+)
+
+// SMTPSettings is the configuration for sending email, STARTTLS is used when the server supports it
+type SMTPSettings struct {
+	From     string   `mapstructure:"from"`
+	Host     string   `mapstructure:"host"`
+	Password string   `mapstructure:"password" secret:"true"`
+	Port     uint     `mapstructure:"port"`
+	To       []string `mapstructure:"to"`
+	Username string   `mapstructure:"username"` // Authentication is skipped when empty
+}
+
+// Defaults sets the default values for the settings
+func (s SMTPSettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".port", uint(587))
+}
+
+func (s SMTPSettings) validate() error {
+	var errs []error
+	if s.Host == "" {
+		errs = append(errs, validation.New("host", ErrorEmptyHost))
+	}
+	if s.From == "" {
+		errs = append(errs, validation.New("from", ErrorEmptyFrom))
+	}
+	if len(s.To) == 0 {
+		errs = append(errs, validation.New("to", ErrorEmptyRecipient))
+	}
+	return errors.Join(errs...)
+}
+
+type smtpSender struct {
+	settings SMTPSettings
+	timeout  time.Duration // Applies to the whole conversation with the server, smtp.SendMail has no timeout at all
+}
+
+func (s *smtpSender) send(title, message string, notification Notification) error {
+	address := net.JoinHostPort(s.settings.Host, strconv.FormatUint(uint64(s.settings.Port), 10))
+	conn, err := (&net.Dialer{Timeout: s.timeout}).Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.settings.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// The same steps as smtp.SendMail
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.settings.Host}); err != nil {
+			return err
+		}
+	}
+	if s.settings.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.settings.Username, s.settings.Password, s.settings.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(s.settings.From); err != nil {
+		return err
+	}
+	for _, to := range s.settings.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(email(s.settings.From, s.settings.To, title, message, notification.Time)); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// email builds a plain text email, line breaks are removed from the subject to prevent header injection
+func email(from string, to []string, subject, body string, date time.Time) []byte {
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	return []byte("From: " + from + "\r\n" +
+		"To: " + strings.Join(to, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + date.Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n") + "\r\n")
+}
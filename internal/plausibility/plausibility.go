@@ -0,0 +1,150 @@
+package plausibility
+
+import (
+	"errors"
+	"fmt"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorImplausible            string = "implausible reading"
+	ErrorNegativeMaxTotalChange string = "max total increase must not be negative"
+	ErrorNegativeResolution     string = "resolution must not be negative"
+	ErrorNegativeTolerance      string = "tolerance must not be negative"
+)
+
+// Reasons why a reading is rejected
+const (
+	ReasonNowAboveRated   string = "current power above the rated power"
+	ReasonTodayAboveRated string = "yield today above the rated power for the elapsed time of the day"
+	ReasonTotalDecreased  string = "total yield decreased"
+	ReasonTotalAboveRated string = "total yield increased more than the rated power allows"
+	ReasonTotalAboveMax   string = "total yield increased more than the max total increase allows"
+	ReasonTotalZero       string = "total yield is 0 without an accepted reading to compare with"
+)
+
+// Settings is the configuration for the plausibility checks of the readings
+type Settings struct {
+	Enabled               bool    `mapstructure:"enabled"`
+	RatedPower            uint    `mapstructure:"rated_power"`        // Rated power of the installation in W, 0 disables the checks based on the rated power
+	MaxTotalIncreaseInKWh float64 `mapstructure:"max_total_increase"` // Increase of the total yield per hour allowed without a rated power, 0 disables the check
+	MaxRejections         uint    `mapstructure:"max_rejections"`     // Consecutive rejected readings after which the last accepted reading is dropped as reference, 0 never drops it
+	ResolutionInKWh       float64 `mapstructure:"resolution"`         // Rounding of the yields reported by the inverter, added to the energy bounds
+	ToleranceInPercents   float64 `mapstructure:"tolerance"`          // Margin on top of the rated power before a reading is rejected
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".enabled", true)
+	v.SetDefault(setting+".rated_power", uint(0))
+	// Without a rated power the size of the installation is unknown, a fixed limit would reject the readings of a large one
+	v.SetDefault(setting+".max_total_increase", float64(0))
+	v.SetDefault(setting+".max_rejections", uint(10))
+	v.SetDefault(setting+".resolution", float64(0.1))
+	v.SetDefault(setting+".tolerance", float64(10))
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.MaxTotalIncreaseInKWh < 0 {
+		errs = append(errs, validation.New("max_total_increase", ErrorNegativeMaxTotalChange))
+	}
+	if s.ResolutionInKWh < 0 {
+		errs = append(errs, validation.New("resolution", ErrorNegativeResolution))
+	}
+	if s.ToleranceInPercents < 0 {
+		errs = append(errs, validation.New("tolerance", ErrorNegativeTolerance))
+	}
+	return errors.Join(errs...)
+}
+
+// NewChecker creates a Checker, it returns nil when the checks are disabled
+func (s Settings) NewChecker() *Checker {
+	if !s.Enabled {
+		return nil
+	}
+	return &Checker{
+		maxPower:         float64(s.RatedPower) * (1 + s.ToleranceInPercents/100),
+		maxTotalIncrease: s.MaxTotalIncreaseInKWh,
+		maxRejections:    s.MaxRejections,
+		resolution:       s.ResolutionInKWh,
+	}
+}
+
+// Checker rejects readings that can not be produced by the installation.
+// It remembers the last accepted reading, so rejected readings never become the reference.
+// After too many consecutive rejections the reference is dropped, as the rejected readings are then more likely right than the reference.
+type Checker struct {
+	maxPower         float64 // in W including the tolerance, 0 when no rated power is configured
+	maxTotalIncrease float64 // in kWh per hour, only used when no rated power is configured
+	maxRejections    uint
+	resolution       float64 // in kWh
+	last             influx.SolarMetrics
+	lastTime         time.Time
+	populated        bool
+	rejections       uint
+}
+
+// Check returns an error with the reason when the reading is implausible, a nil Checker accepts every reading
+func (c *Checker) Check(metrics influx.SolarMetrics, reportTime time.Time) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.check(metrics, reportTime); err != nil {
+		c.rejections++
+		if c.maxRejections > 0 && c.rejections >= c.maxRejections {
+			c.populated = false
+			c.rejections = 0
+		}
+		return fmt.Errorf("%s: %w", ErrorImplausible, err)
+	}
+	c.rejections = 0
+	c.last = metrics
+	c.lastTime = reportTime
+	c.populated = true
+	return nil
+}
+
+func (c *Checker) check(metrics influx.SolarMetrics, reportTime time.Time) error {
+	// An inverter that starts up can report a total yield of 0, as the reference it would reject the following readings
+	if !c.populated && metrics.Total == 0 {
+		return errors.New(ReasonTotalZero)
+	}
+	if c.populated && metrics.Total < c.last.Total {
+		return fmt.Errorf("%s (%.2f kWh < %.2f kWh)", ReasonTotalDecreased, metrics.Total, c.last.Total)
+	}
+	if c.maxPower == 0 {
+		// Without a rated power only a spike of the total yield is rejected, it would otherwise become the reference
+		if c.populated && c.maxTotalIncrease > 0 {
+			increase := metrics.Total - c.last.Total
+			if maxIncrease := c.maxTotalIncrease*reportTime.Sub(c.lastTime).Hours() + c.resolution; increase > maxIncrease {
+				return fmt.Errorf("%s (%.2f kWh > %.2f kWh)", ReasonTotalAboveMax, increase, maxIncrease)
+			}
+		}
+		return nil
+	}
+	if !metrics.NowNil && float64(metrics.Now) > c.maxPower {
+		return fmt.Errorf("%s (%d W > %.0f W)", ReasonNowAboveRated, metrics.Now, c.maxPower)
+	}
+	midnight := time.Date(reportTime.Year(), reportTime.Month(), reportTime.Day(), 0, 0, 0, 0, reportTime.Location())
+	if maxToday := energy(c.maxPower, reportTime.Sub(midnight)) + c.resolution; metrics.Today > maxToday {
+		return fmt.Errorf("%s (%.2f kWh > %.2f kWh)", ReasonTodayAboveRated, metrics.Today, maxToday)
+	}
+	if c.populated {
+		increase := metrics.Total - c.last.Total
+		if maxIncrease := energy(c.maxPower, reportTime.Sub(c.lastTime)) + c.resolution; increase > maxIncrease {
+			return fmt.Errorf("%s (%.2f kWh > %.2f kWh)", ReasonTotalAboveRated, increase, maxIncrease)
+		}
+	}
+	return nil
+}
+
+// energy returns the energy in kWh produced at the power in W during the duration
+func energy(power float64, duration time.Duration) float64 {
+	return power * duration.Hours() / 1000
+}
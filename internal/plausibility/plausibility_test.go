@@ -0,0 +1,147 @@
+package plausibility
+
+import (
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Checker_Check(t *testing.T) {
+	type reading struct {
+		minutes int
+		metrics influx.SolarMetrics
+		reason  string
+	}
+	noon := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		settings Settings
+		readings []reading
+	}{
+		{name: "Disabled accepts everything",
+			settings: Settings{RatedPower: 1000},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Now: 5000, Total: 100}},
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 0}},
+			},
+		},
+		{name: "Total decreased",
+			settings: Settings{Enabled: true},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Total: 100}},
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 0}, reason: ReasonTotalDecreased},
+				{minutes: 2, metrics: influx.SolarMetrics{Total: 100.1}},
+			},
+		},
+		{name: "Now above rated power",
+			settings: Settings{Enabled: true, RatedPower: 1000, ToleranceInPercents: 10},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Now: 1100, Total: 100}},
+				{minutes: 1, metrics: influx.SolarMetrics{Now: 1101, Total: 100}, reason: ReasonNowAboveRated},
+				{minutes: 2, metrics: influx.SolarMetrics{Now: 1101, NowNil: true, Total: 100}},
+			},
+		},
+		{name: "Today above elapsed time",
+			settings: Settings{Enabled: true, RatedPower: 1000, ResolutionInKWh: 0.1},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Today: 12.05, Total: 100}},
+				{minutes: 1, metrics: influx.SolarMetrics{Today: 12.2, Total: 100}, reason: ReasonTodayAboveRated},
+			},
+		},
+		{name: "Total spike",
+			settings: Settings{Enabled: true, RatedPower: 6000, ResolutionInKWh: 0.1},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Total: 1000}},
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 1000.15}},
+				{minutes: 2, metrics: influx.SolarMetrics{Total: 11000}, reason: ReasonTotalAboveRated},
+				{minutes: 60, metrics: influx.SolarMetrics{Total: 1006}},
+			},
+		},
+		{name: "Total spike without rated power",
+			settings: Settings{Enabled: true, MaxTotalIncreaseInKWh: 50, ResolutionInKWh: 0.1},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Total: 1000}},
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 11000}, reason: ReasonTotalAboveMax},
+				// The spike did not become the reference, so the following readings are accepted
+				{minutes: 2, metrics: influx.SolarMetrics{Total: 1000.1}},
+				{minutes: 3, metrics: influx.SolarMetrics{Total: 1000.2}},
+			},
+		},
+		{name: "Total 0 without reference",
+			settings: Settings{Enabled: true, MaxRejections: 2},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Total: 0}, reason: ReasonTotalZero},
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 1000}},
+				{minutes: 2, metrics: influx.SolarMetrics{Total: 1000.1}},
+				{minutes: 3, metrics: influx.SolarMetrics{Total: 0}, reason: ReasonTotalDecreased},
+				{minutes: 4, metrics: influx.SolarMetrics{Total: 0}, reason: ReasonTotalDecreased},
+				// The dropped reference is not replaced by a reading with a total yield of 0
+				{minutes: 5, metrics: influx.SolarMetrics{Total: 0}, reason: ReasonTotalZero},
+				{minutes: 6, metrics: influx.SolarMetrics{Total: 1000.2}},
+			},
+		},
+		{name: "Reference dropped after max rejections",
+			settings: Settings{Enabled: true, MaxRejections: 2},
+			readings: []reading{
+				{metrics: influx.SolarMetrics{Total: 1000}},
+				// The counter of a replaced inverter starts again
+				{minutes: 1, metrics: influx.SolarMetrics{Total: 5}, reason: ReasonTotalDecreased},
+				{minutes: 2, metrics: influx.SolarMetrics{Total: 5.1}, reason: ReasonTotalDecreased},
+				{minutes: 3, metrics: influx.SolarMetrics{Total: 5.2}},
+				{minutes: 4, metrics: influx.SolarMetrics{Total: 5.1}, reason: ReasonTotalDecreased},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			checker := test.settings.NewChecker()
+			if !test.settings.Enabled {
+				require.Nil(t, checker, test.name)
+			}
+			for _, r := range test.readings {
+				err := checker.Check(r.metrics, noon.Add(time.Duration(r.minutes)*time.Minute))
+				if r.reason == "" {
+					require.NoError(t, err, test.name)
+				} else {
+					require.ErrorContains(t, err, ErrorImplausible+": "+r.reason, test.name)
+				}
+			}
+		})
+	}
+}
+
+func Test_Settings_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		output   string
+	}{
+		{name: "Valid",
+			settings: Settings{Enabled: true, RatedPower: 5000, ResolutionInKWh: 0.1, ToleranceInPercents: 10},
+		},
+		{name: "Negative resolution",
+			settings: Settings{ResolutionInKWh: -1},
+			output:   "resolution: " + ErrorNegativeResolution,
+		},
+		{name: "Negative max total increase",
+			settings: Settings{MaxTotalIncreaseInKWh: -1},
+			output:   "max_total_increase: " + ErrorNegativeMaxTotalChange,
+		},
+		{name: "Negative tolerance",
+			settings: Settings{ToleranceInPercents: -1},
+			output:   "tolerance: " + ErrorNegativeTolerance,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.settings.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_quoteTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{name: "Table",
+			input:  "solar_metrics",
+			output: `"solar_metrics"`,
+		},
+		{name: "Schema and table",
+			input:  "metrics.Solar",
+			output: `"metrics"."Solar"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			require.Equal(t, test.output, quoteTable(test.input), test.name)
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Settings
+		output string
+	}{
+		{name: "Valid",
+			input: Settings{Url: "postgres://localhost:5432/solar", Table: "solar_metrics"},
+		},
+		{name: "Valid schema",
+			input: Settings{Url: "postgres://localhost:5432/solar", Table: "public.solar_metrics"},
+		},
+		{name: "ErrorEmptyUrl",
+			input:  Settings{Table: "solar_metrics"},
+			output: "url: " + ErrorEmptyUrl,
+		},
+		{name: "ErrorInvalidTable empty",
+			input:  Settings{Url: "postgres://localhost:5432/solar"},
+			output: "table: " + ErrorInvalidTable,
+		},
+		{name: "ErrorInvalidTable injection",
+			input:  Settings{Url: "postgres://localhost:5432/solar", Table: `solar"; DROP TABLE users; --`},
+			output: "table: " + ErrorInvalidTable,
+		},
+		{name: "ErrorInvalidTable too many parts",
+			input:  Settings{Url: "postgres://localhost:5432/solar", Table: "a.b.c"},
+			output: "table: " + ErrorInvalidTable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
+
+func Test_upsertQuery(t *testing.T) {
+	query := upsertQuery(quoteTable("metrics.solar"))
+	require.Contains(t, query, `INSERT INTO "metrics"."solar" (host, time, current_power, yield_today, total_yield, substituted)`)
+	// Write passes the host, time, current power, yield today, total yield and substituted in this order
+	require.Contains(t, query, "VALUES ($1, $2, $3, $4, $5, $6)")
+	require.Len(t, regexp.MustCompile(`\$\d`).FindAllString(query, -1), 6)
+	// The conflict target is the primary key of the created table
+	require.Contains(t, createTableQuery("solar"), "PRIMARY KEY (host, time)")
+	require.Contains(t, query, "ON CONFLICT (host, time) DO UPDATE SET")
+	for _, column := range []string{"current_power", "yield_today", "total_yield", "substituted"} {
+		require.Regexp(t, column+`\s+= EXCLUDED\.`+column, query)
+	}
+	require.NotRegexp(t, `host\s+= EXCLUDED`, query)
+}
+
+func Test_createHypertableQuery(t *testing.T) {
+	// Without migrate_data the conversion of a table with rows fails
+	require.Contains(t, createHypertableQuery, "migrate_data => TRUE")
+	require.Contains(t, createHypertableQuery, "if_not_exists => TRUE")
+}
@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyListen string = "empty listen address"
+	ErrorEmptyPath   string = "empty path"
+)
+
+const contentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+// Settings is the configuration for the Prometheus exporter
+type Settings struct {
+	Listen string      `mapstructure:"listen"`
+	Path   string      `mapstructure:"path"`
+	Tags   influx.Tags `mapstructure:"tags"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".listen", ":9484")
+	v.SetDefault(setting+".path", "/metrics")
+	s.Tags.Defaults(v, setting+".tags")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Listen == "" {
+		errs = append(errs, validation.New("listen", ErrorEmptyListen))
+	}
+	if s.Path == "" {
+		errs = append(errs, validation.New("path", ErrorEmptyPath))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter starts the HTTP listener and returns the exporter
+func (s Settings) CreateWriter() (*Exporter, error) {
+	listener, err := net.Listen("tcp", s.Listen)
+	if err != nil {
+		return nil, err
+	}
+	exporter := &Exporter{tags: s.Tags, listener: listener}
+	mux := http.NewServeMux()
+	mux.Handle(s.Path, exporter)
+	go func() {
+		err := http.Serve(listener, mux)
+		exporter.mutex.Lock()
+		exporter.serveErr = err
+		exporter.mutex.Unlock()
+	}()
+	return exporter, nil
+}
+
+// Exporter is a MetricsWriter that exposes the latest metrics in the Prometheus text format
+type Exporter struct {
+	tags        influx.Tags
+	listener    net.Listener
+	mutex       sync.Mutex
+	serveErr    error
+	metrics     influx.SolarMetrics
+	populated   bool
+	success     bool
+	errorCount  uint64
+	lastSuccess time.Time
+}
+
+// Ping checks if the HTTP listener is still running
+func (e *Exporter) Ping() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.serveErr
+}
+
+// Close stops the HTTP listener
+func (e *Exporter) Close() error {
+	return e.listener.Close()
+}
+
+// Write stores the metrics to be exposed on the next request
+func (e *Exporter) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.metrics = metrics
+	e.populated = true
+	return nil
+}
+
+// ObserveScrape keeps track of the scrape success and error count
+func (e *Exporter) ObserveScrape(err error, scrapeTime time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.success = err == nil
+	if err != nil {
+		e.errorCount++
+		return
+	}
+	e.lastSuccess = scrapeTime
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.writeMetrics(w)
+}
+
+func (e *Exporter) writeMetrics(w io.Writer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	labels := `{host="` + escapeLabel(e.tags.Host) + `"}`
+	if e.populated {
+		if !e.metrics.NowNil {
+			writeMetric(w, "solar_current_power_watts", "gauge", "Current power output of the inverter.", labels, float64(e.metrics.Now))
+		}
+		writeMetric(w, "solar_yield_today_kwh", "gauge", "Energy yield of the current day.", labels, e.metrics.Today)
+		writeMetric(w, "solar_yield_kwh_total", "counter", "Total energy yield of the inverter.", labels, e.metrics.Total)
+	}
+	writeMetric(w, "solar_scrape_success", "gauge", "Whether the last scrape of the inverter succeeded.", labels, boolToFloat(e.success))
+	writeMetric(w, "solar_scrape_errors_total", "counter", "Number of failed scrapes of the inverter.", labels, float64(e.errorCount))
+	if !e.lastSuccess.IsZero() {
+		writeMetric(w, "solar_last_successful_scrape_timestamp_seconds", "gauge", "Unix time of the last successful scrape.", labels, float64(e.lastSuccess.Unix()))
+	}
+}
+
+func writeMetric(w io.Writer, name, metricType, help, labels string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s%s %s\n", name, help, name, metricType, name, labels, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package prometheus
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Exporter_ServeHTTP(t *testing.T) {
+	scrapeTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		input  func(*Exporter)
+		output string
+	}{
+		{name: "No data",
+			input: func(e *Exporter) {},
+			output: `# HELP solar_scrape_success Whether the last scrape of the inverter succeeded.
+# TYPE solar_scrape_success gauge
+solar_scrape_success{host="my-host"} 0
+# HELP solar_scrape_errors_total Number of failed scrapes of the inverter.
+# TYPE solar_scrape_errors_total counter
+solar_scrape_errors_total{host="my-host"} 0
+`,
+		},
+		{name: "Successful scrape",
+			input: func(e *Exporter) {
+				e.ObserveScrape(nil, scrapeTime)
+				_ = e.Write(influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2}, scrapeTime, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			},
+			output: `# HELP solar_current_power_watts Current power output of the inverter.
+# TYPE solar_current_power_watts gauge
+solar_current_power_watts{host="my-host"} 150
+# HELP solar_yield_today_kwh Energy yield of the current day.
+# TYPE solar_yield_today_kwh gauge
+solar_yield_today_kwh{host="my-host"} 3.1
+# HELP solar_yield_kwh_total Total energy yield of the inverter.
+# TYPE solar_yield_kwh_total counter
+solar_yield_kwh_total{host="my-host"} 4756.2
+# HELP solar_scrape_success Whether the last scrape of the inverter succeeded.
+# TYPE solar_scrape_success gauge
+solar_scrape_success{host="my-host"} 1
+# HELP solar_scrape_errors_total Number of failed scrapes of the inverter.
+# TYPE solar_scrape_errors_total counter
+solar_scrape_errors_total{host="my-host"} 0
+# HELP solar_last_successful_scrape_timestamp_seconds Unix time of the last successful scrape.
+# TYPE solar_last_successful_scrape_timestamp_seconds gauge
+solar_last_successful_scrape_timestamp_seconds{host="my-host"} 1700000000
+`,
+		},
+		{name: "Substituted after failed scrape",
+			input: func(e *Exporter) {
+				e.ObserveScrape(nil, scrapeTime)
+				e.ObserveScrape(errors.New("test error"), scrapeTime.Add(time.Minute))
+				_ = e.Write(influx.SolarMetrics{NowNil: true, Today: 3.1, Total: 4756.2}, scrapeTime, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			},
+			output: `# HELP solar_yield_today_kwh Energy yield of the current day.
+# TYPE solar_yield_today_kwh gauge
+solar_yield_today_kwh{host="my-host"} 3.1
+# HELP solar_yield_kwh_total Total energy yield of the inverter.
+# TYPE solar_yield_kwh_total counter
+solar_yield_kwh_total{host="my-host"} 4756.2
+# HELP solar_scrape_success Whether the last scrape of the inverter succeeded.
+# TYPE solar_scrape_success gauge
+solar_scrape_success{host="my-host"} 0
+# HELP solar_scrape_errors_total Number of failed scrapes of the inverter.
+# TYPE solar_scrape_errors_total counter
+solar_scrape_errors_total{host="my-host"} 1
+# HELP solar_last_successful_scrape_timestamp_seconds Unix time of the last successful scrape.
+# TYPE solar_last_successful_scrape_timestamp_seconds gauge
+solar_last_successful_scrape_timestamp_seconds{host="my-host"} 1700000000
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			exporter := &Exporter{tags: influx.Tags{Host: "my-host"}}
+			test.input(exporter)
+			recorder := httptest.NewRecorder()
+			exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			require.Equal(t, contentType, recorder.Header().Get("Content-Type"), test.name)
+			require.Equal(t, test.output, recorder.Body.String(), test.name)
+		})
+	}
+}
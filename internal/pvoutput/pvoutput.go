@@ -0,0 +1,338 @@
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyApiKey     string = "empty api key"
+	ErrorEmptySystemID   string = "empty system id"
+	ErrorEmptyUrl        string = "empty url"
+	ErrorInvalidInterval string = "invalid interval, expected 5, 10 or 15 minutes"
+	ErrorInvalidBatch    string = "batch size must be between 1 and 100"
+	ErrorRateLimited     string = "rate limit exceeded, retrying after"
+)
+
+const (
+	addStatusPath      string = "/service/r2/addstatus.jsp"
+	addBatchStatusPath string = "/service/r2/addbatchstatus.jsp"
+	headerApiKey       string = "X-Pvoutput-Apikey"
+	headerSystemID     string = "X-Pvoutput-SystemId"
+	headerRateLimit    string = "X-Rate-Limit" // Requests the rate limit headers in the response
+	headerRemaining    string = "X-Rate-Limit-Remaining"
+	headerReset        string = "X-Rate-Limit-Reset"
+	dateFormat         string = "20060102"
+	timeFormat         string = "15:04"
+)
+
+// Settings is the configuration for the PVOutput uploader
+type Settings struct {
+	ApiKey            string `mapstructure:"api_key" secret:"true"`
+	BatchSize         uint   `mapstructure:"batch_size"`   // Statuses per addbatchstatus request, 30 for regular and 100 for donating accounts
+	IntervalInMinutes uint   `mapstructure:"interval"`     // Status interval configured for the system in PVOutput
+	MaxAgeInDays      uint   `mapstructure:"max_age_days"` // Statuses older than this are dropped, 14 for regular and 90 for donating accounts
+	SystemID          string `mapstructure:"system_id"`
+	Timeout           uint   `mapstructure:"timeout"`
+	Url               string `mapstructure:"url"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".batch_size", uint(30))
+	v.SetDefault(setting+".interval", uint(5))
+	v.SetDefault(setting+".max_age_days", uint(14))
+	v.SetDefault(setting+".timeout", uint(5))
+	v.SetDefault(setting+".url", "https://pvoutput.org")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.ApiKey == "" {
+		errs = append(errs, validation.New("api_key", ErrorEmptyApiKey))
+	}
+	if s.SystemID == "" {
+		errs = append(errs, validation.New("system_id", ErrorEmptySystemID))
+	}
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	if s.IntervalInMinutes != 5 && s.IntervalInMinutes != 10 && s.IntervalInMinutes != 15 {
+		errs = append(errs, validation.New("interval", ErrorInvalidInterval))
+	}
+	if s.BatchSize == 0 || s.BatchSize > 100 {
+		errs = append(errs, validation.New("batch_size", ErrorInvalidBatch))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter creates the uploader
+func (s Settings) CreateWriter() *Uploader {
+	return &Uploader{
+		settings: s,
+		client:   &http.Client{Timeout: time.Duration(s.Timeout) * time.Second},
+		interval: time.Duration(s.IntervalInMinutes) * time.Minute,
+		now:      time.Now,
+	}
+}
+
+// status is the aggregate of all readings in a single interval
+type status struct {
+	end        time.Time
+	energy     float64 // Energy generated today in Wh
+	powerSum   uint
+	powerCount uint
+}
+
+func (s status) values() []string {
+	values := []string{s.end.Format(dateFormat), s.end.Format(timeFormat), strconv.FormatFloat(s.energy, 'f', 0, 64), ""}
+	if s.powerCount > 0 {
+		values[3] = strconv.FormatUint(uint64(s.powerSum/s.powerCount), 10)
+	}
+	return values
+}
+
+// Uploader is a MetricsWriter that aggregates the readings into PVOutput status intervals and uploads them
+type Uploader struct {
+	settings     Settings
+	client       *http.Client
+	interval     time.Duration
+	now          func() time.Time
+	uploading    sync.Mutex // Held during the uploads, so a status is not uploaded twice
+	mutex        sync.Mutex // Held while the statuses are changed, not during the uploads
+	current      *status
+	timer        *time.Timer // Completes the current interval at its end
+	pending      []status    // Completed intervals that are not uploaded yet, oldest first
+	blockedUntil time.Time
+	logger       *slog.Logger // Logger of the last write, used when uploading outside of a write
+}
+
+// Ping checks if PVOutput is reachable
+func (u *Uploader) Ping() error {
+	resp, err := u.client.Get(u.settings.Url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close completes the current interval and uploads the pending statuses when the rate limit allows it
+func (u *Uploader) Close() error {
+	u.mutex.Lock()
+	logger := u.logger
+	if u.current != nil {
+		u.complete()
+	}
+	u.mutex.Unlock()
+	if logger == nil {
+		return nil
+	}
+	return u.flush(logger)
+}
+
+// Write adds the reading to its interval, completed intervals are uploaded when the rate limit allows it
+func (u *Uploader) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	u.mutex.Lock()
+	u.logger = logger
+	end := intervalEnd(reportTime, u.interval)
+	if u.current != nil && !u.current.end.Equal(end) {
+		u.complete()
+	}
+	if u.current == nil {
+		u.current = &status{end: end}
+		// An interval in the past, like a replayed one, is completed by the first reading of the next interval
+		if wait := end.Sub(u.now()); wait > 0 {
+			u.timer = time.AfterFunc(wait, func() { u.completeInterval(end) })
+		}
+	}
+	u.current.energy = metrics.Today * 1000
+	if !metrics.NowNil {
+		u.current.powerSum += metrics.Now
+		u.current.powerCount++
+	}
+	u.mutex.Unlock()
+	return u.flush(logger)
+}
+
+// complete moves the current interval to the pending statuses, the mutex must be held
+func (u *Uploader) complete() {
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+	u.pending = append(u.pending, *u.current)
+	u.current = nil
+}
+
+// completeInterval completes the current interval when it ends at end and uploads it, so the last interval
+// of the polling window does not wait for the next reading
+func (u *Uploader) completeInterval(end time.Time) {
+	u.mutex.Lock()
+	if u.current == nil || !u.current.end.Equal(end) {
+		u.mutex.Unlock()
+		return
+	}
+	u.complete()
+	logger := u.logger
+	u.mutex.Unlock()
+	if err := u.flush(logger); err != nil {
+		logger.Error("uploading statuses failed", "error", err)
+	}
+}
+
+// intervalEnd returns the end of the interval the time belongs to, PVOutput reports statuses at the end of the interval
+func intervalEnd(t time.Time, interval time.Duration) time.Time {
+	t = t.Local()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight).Truncate(interval) + interval)
+}
+
+// flush uploads the pending statuses, single statuses are sent with addstatus and backfills with addbatchstatus.
+// Statuses rejected by PVOutput are dropped, so they do not block the statuses after them.
+func (u *Uploader) flush(logger *slog.Logger) error {
+	u.uploading.Lock()
+	defer u.uploading.Unlock()
+	var errs []error
+	for {
+		// Only flush removes statuses, so the uploaded ones are still the first pending ones afterwards
+		u.mutex.Lock()
+		u.dropExpired()
+		if len(u.pending) == 0 || u.now().Before(u.blockedUntil) {
+			u.mutex.Unlock()
+			return errors.Join(errs...)
+		}
+		count := len(u.pending)
+		if count > int(u.settings.BatchSize) {
+			count = int(u.settings.BatchSize)
+		}
+		statuses := append([]status(nil), u.pending[:count]...)
+		u.mutex.Unlock()
+		var err error
+		if count == 1 {
+			err = u.addStatus(statuses[0])
+		} else {
+			err = u.addBatchStatus(statuses, logger)
+		}
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			logger.Error("statuses rejected, dropping them", "count", count, "error", err)
+			errs = append(errs, err)
+		} else if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		u.mutex.Lock()
+		u.pending = u.pending[count:]
+		u.mutex.Unlock()
+	}
+}
+
+// dropExpired drops the statuses PVOutput does not accept anymore, the mutex must be held
+func (u *Uploader) dropExpired() {
+	oldest := u.now().AddDate(0, 0, -int(u.settings.MaxAgeInDays))
+	for len(u.pending) > 0 && u.pending[0].end.Before(oldest) {
+		u.pending = u.pending[1:]
+	}
+}
+
+func (u *Uploader) addStatus(s status) error {
+	values := s.values()
+	form := url.Values{"d": {values[0]}, "t": {values[1]}, "v1": {values[2]}}
+	if values[3] != "" {
+		form.Set("v2", values[3])
+	}
+	_, err := u.post(addStatusPath, form)
+	return err
+}
+
+// addBatchStatus uploads the statuses, the response has the date, time and a 1 for every added status
+func (u *Uploader) addBatchStatus(statuses []status, logger *slog.Logger) error {
+	data := make([]string, len(statuses))
+	for i, s := range statuses {
+		data[i] = strings.Join(s.values(), ",")
+	}
+	body, err := u.post(addBatchStatusPath, url.Values{"data": {strings.Join(data, ";")}})
+	if err != nil {
+		return err
+	}
+	for _, result := range strings.Split(strings.TrimSpace(body), ";") {
+		// An existing status of the same time is not added again, this is not retried
+		if fields := strings.Split(result, ","); len(fields) == 3 && fields[2] != "1" {
+			logger.Warn("status not added", "date", fields[0], "time", fields[1])
+		}
+	}
+	return nil
+}
+
+// rejectedError is returned for a request PVOutput will never accept, like a status older than allowed
+type rejectedError struct {
+	status string
+	body   string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("pvoutput: %s: %s", e.status, e.body)
+}
+
+// post sends the form and returns the body of the response
+func (u *Uploader) post(path string, form url.Values) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, u.settings.Url+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(headerApiKey, u.settings.ApiKey)
+	req.Header.Set(headerSystemID, u.settings.SystemID)
+	req.Header.Set(headerRateLimit, "1")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	u.mutex.Lock()
+	u.updateRateLimit(resp)
+	if resp.StatusCode == http.StatusForbidden && strings.Contains(string(body), "Exceeded") {
+		if !u.blockedUntil.After(u.now()) {
+			u.blockedUntil = u.now().Add(time.Hour)
+		}
+		blockedUntil := u.blockedUntil
+		u.mutex.Unlock()
+		return "", fmt.Errorf("%s %s", ErrorRateLimited, blockedUntil.Format(time.RFC3339))
+	}
+	u.mutex.Unlock()
+	// An invalid api key or system id rejects every request, those are kept until the settings are fixed
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return "", &rejectedError{status: resp.Status, body: strings.TrimSpace(string(body))}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("pvoutput: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// updateRateLimit blocks further requests until the reset time when no requests are remaining, the mutex must be held
+func (u *Uploader) updateRateLimit(resp *http.Response) {
+	if resp.Header.Get(headerRemaining) != "0" {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(headerReset), 10, 64)
+	if err != nil {
+		u.blockedUntil = u.now().Add(time.Hour)
+		return
+	}
+	u.blockedUntil = time.Unix(reset, 0)
+}
@@ -0,0 +1,261 @@
+package pvoutput
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"solar-scraper/internal/influx"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	path string
+	form url.Values
+}
+
+// standIn is a local stand-in of the PVOutput API
+type standIn struct {
+	mutex     sync.Mutex
+	requests  []request
+	status    int
+	body      string
+	remaining string
+	reset     time.Time
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if r.Header.Get(headerApiKey) != "api-key" || r.Header.Get(headerSystemID) != "1234" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_ = r.ParseForm()
+	s.requests = append(s.requests, request{path: r.URL.Path, form: r.PostForm})
+	// PVOutput only sends the rate limit headers when they are requested
+	if s.remaining != "" && r.Header.Get(headerRateLimit) == "1" {
+		w.Header().Set(headerRemaining, s.remaining)
+		w.Header().Set(headerReset, strconv.FormatInt(s.reset.Unix(), 10))
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+	_, _ = w.Write([]byte(s.body))
+}
+
+func newTestUploader(server *httptest.Server, now *time.Time) *Uploader {
+	uploader := Settings{ApiKey: "api-key", SystemID: "1234", Url: server.URL, IntervalInMinutes: 5, BatchSize: 2, MaxAgeInDays: 14, Timeout: 5}.CreateWriter()
+	uploader.now = func() time.Time { return *now }
+	return uploader
+}
+
+func Test_intervalEnd(t *testing.T) {
+	day := time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		input    time.Time
+		interval time.Duration
+		output   time.Time
+	}{
+		{name: "Start of interval",
+			input:    day.Add(10 * time.Hour),
+			interval: 5 * time.Minute,
+			output:   day.Add(10*time.Hour + 5*time.Minute),
+		},
+		{name: "Within interval",
+			input:    day.Add(10*time.Hour + 7*time.Minute + 30*time.Second),
+			interval: 5 * time.Minute,
+			output:   day.Add(10*time.Hour + 10*time.Minute),
+		},
+		{name: "15 minutes",
+			input:    day.Add(10*time.Hour + 14*time.Minute),
+			interval: 15 * time.Minute,
+			output:   day.Add(10*time.Hour + 15*time.Minute),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			require.Equal(t, test.output, intervalEnd(test.input, test.interval), test.name)
+		})
+	}
+}
+
+func Test_Uploader_Write(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+	api := &standIn{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	now := start
+	uploader := newTestUploader(server, &now)
+
+	// Readings in the same interval are averaged and only uploaded once the interval is complete
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.0}, now, discard))
+	now = start.Add(2 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 200, Today: 1.01}, now, discard))
+	now = start.Add(3 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{NowNil: true, Today: 1.01}, now, discard))
+	require.Empty(t, api.requests)
+	now = start.Add(5 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 300, Today: 1.03}, now, discard))
+	require.Equal(t, []request{{path: addStatusPath, form: url.Values{"d": {"20230601"}, "t": {"10:05"}, "v1": {"1010"}, "v2": {"150"}}}}, api.requests)
+
+	// Failed uploads are kept and backfilled in batches
+	api.requests = nil
+	api.status = http.StatusInternalServerError
+	for i := 2; i <= 4; i++ {
+		now = start.Add(time.Duration(i*5) * time.Minute)
+		require.Error(t, uploader.Write(influx.SolarMetrics{Now: uint(i * 100), Today: 1 + float64(i)/100}, now, discard))
+	}
+	require.Len(t, api.requests, 3)
+	api.requests = nil
+	api.status = http.StatusOK
+	now = start.Add(25 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{NowNil: true, Today: 1.05}, now, discard))
+	require.Equal(t, []request{
+		{path: addBatchStatusPath, form: url.Values{"data": {"20230601,10:10,1030,300;20230601,10:15,1020,200"}}},
+		{path: addBatchStatusPath, form: url.Values{"data": {"20230601,10:20,1030,300;20230601,10:25,1040,400"}}},
+	}, api.requests)
+	require.Empty(t, uploader.pending)
+}
+
+func Test_Uploader_Close(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+	api := &standIn{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	now := start
+	uploader := newTestUploader(server, &now)
+
+	// Nothing was written, nothing is uploaded
+	require.NoError(t, uploader.Close())
+	require.Empty(t, api.requests)
+
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.0}, now, discard))
+	require.NoError(t, uploader.Close())
+	require.Equal(t, []request{{path: addStatusPath, form: url.Values{"d": {"20230601"}, "t": {"10:05"}, "v1": {"1000"}, "v2": {"100"}}}}, api.requests)
+	require.Nil(t, uploader.current)
+	require.Empty(t, uploader.pending)
+}
+
+func Test_Uploader_completeInterval(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+	api := &standIn{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	now := start
+	uploader := newTestUploader(server, &now)
+	defer uploader.Close()
+
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.0}, now, discard))
+	require.NotNil(t, uploader.timer)
+	// The timer of another interval does not complete the current one
+	uploader.completeInterval(start)
+	require.Empty(t, api.requests)
+	// The interval is uploaded at its end without a reading of the next interval
+	now = start.Add(5 * time.Minute)
+	uploader.completeInterval(now)
+	require.Equal(t, []request{{path: addStatusPath, form: url.Values{"d": {"20230601"}, "t": {"10:05"}, "v1": {"1000"}, "v2": {"100"}}}}, api.requests)
+	require.Nil(t, uploader.current)
+	require.Nil(t, uploader.timer)
+}
+
+func Test_Uploader_RateLimit(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+	api := &standIn{remaining: "0", reset: start.Add(time.Hour)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	now := start
+	uploader := newTestUploader(server, &now)
+
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.0}, now, discard))
+	now = start.Add(5 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.1}, now, discard))
+	require.Len(t, api.requests, 1)
+
+	// No requests are made until the reset time
+	now = start.Add(10 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.2}, now, discard))
+	require.Len(t, api.requests, 1)
+	require.Len(t, uploader.pending, 1)
+
+	api.remaining = ""
+	now = start.Add(time.Hour + time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.3}, now, discard))
+	require.Len(t, api.requests, 2)
+	require.Equal(t, addBatchStatusPath, api.requests[1].path)
+	require.Empty(t, uploader.pending)
+
+	// An exceeded rate limit without headers blocks for an hour
+	api.status = http.StatusForbidden
+	api.body = "Forbidden 403: Exceeded 60 requests per hour"
+	now = start.Add(2 * time.Hour)
+	require.ErrorContains(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.4}, now, discard), ErrorRateLimited)
+	require.Equal(t, now.Add(time.Hour), uploader.blockedUntil)
+}
+
+func Test_Uploader_Rejected(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+	api := &standIn{status: http.StatusBadRequest, body: "Bad request 400: Date is older than 14 days"}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	now := start
+	uploader := newTestUploader(server, &now)
+
+	// A rejected status is dropped instead of blocking the following ones
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.0}, now, discard))
+	now = start.Add(5 * time.Minute)
+	require.ErrorContains(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.1}, now, discard), "400")
+	require.Empty(t, uploader.pending)
+
+	api.status = http.StatusOK
+	api.requests = nil
+	now = start.Add(10 * time.Minute)
+	require.NoError(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.2}, now, discard))
+	require.Equal(t, []request{{path: addStatusPath, form: url.Values{"d": {"20230601"}, "t": {"10:10"}, "v1": {"1100"}, "v2": {"100"}}}}, api.requests)
+
+	// An invalid api key rejects every status, they are kept
+	api.status = http.StatusUnauthorized
+	now = start.Add(15 * time.Minute)
+	require.Error(t, uploader.Write(influx.SolarMetrics{Now: 100, Today: 1.3}, now, discard))
+	require.Len(t, uploader.pending, 1)
+}
+
+func Test_Uploader_addBatchStatus(t *testing.T) {
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	start := time.Date(2023, 6, 1, 10, 5, 0, 0, time.Local)
+	api := &standIn{body: "20230601,10:05,1;20230601,10:10,0"}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	uploader := newTestUploader(server, &start)
+
+	require.NoError(t, uploader.addBatchStatus([]status{{end: start}, {end: start.Add(5 * time.Minute)}}, logger))
+	require.Contains(t, logs.String(), "status not added")
+	require.Contains(t, logs.String(), "time=10:10")
+	require.NotContains(t, logs.String(), "time=10:05")
+}
+
+func Test_Uploader_dropExpired(t *testing.T) {
+	now := time.Date(2023, 6, 15, 10, 0, 0, 0, time.Local)
+	uploader := &Uploader{settings: Settings{MaxAgeInDays: 14}, now: func() time.Time { return now }}
+	uploader.pending = []status{
+		{end: now.AddDate(0, 0, -15)},
+		{end: now.AddDate(0, 0, -14).Add(-time.Minute)},
+		{end: now.AddDate(0, 0, -13)},
+	}
+	uploader.dropExpired()
+	require.Equal(t, []status{{end: now.AddDate(0, 0, -13)}}, uploader.pending)
+}
@@ -0,0 +1,261 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const dayFormat string = "2006-01-02"
+
+// Settings is the configuration for the rotation of a file
+type Settings struct {
+	Compress      bool `mapstructure:"compress"`       // Compress rotated files with gzip
+	Daily         bool `mapstructure:"daily"`          // Rotate the file when the day changes
+	MaxSizeInByte uint `mapstructure:"max_size_bytes"` // Rotate the file when it would exceed this size, 0 disables size based rotation
+	MaxFiles      uint `mapstructure:"max_files"`      // Number of rotated files to keep, 0 keeps all
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".compress", false)
+	v.SetDefault(setting+".daily", true)
+	v.SetDefault(setting+".max_size_bytes", uint(0))
+	v.SetDefault(setting+".max_files", uint(0))
+}
+
+// File is an io.WriteCloser that rotates the underlying file based on the settings
+type File struct {
+	path     string
+	settings Settings
+	header   []byte
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	day      string
+	now      func() time.Time
+}
+
+// Open opens or creates the file, the header is written at the start of every new file
+func Open(path string, settings Settings, header []byte) (*File, error) {
+	return openWithClock(path, settings, header, time.Now)
+}
+
+func openWithClock(path string, settings Settings, header []byte, now func() time.Time) (*File, error) {
+	f := &File{
+		path:     path,
+		settings: settings,
+		header:   header,
+		now:      now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes the data to the file, rotating it first when needed
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.close()
+}
+
+// Reopen closes and reopens the file without rotating it, so a file moved by an external tool like logrotate is recreated
+func (f *File) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *File) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.day = f.now().Format(dayFormat)
+	if f.size > 0 {
+		f.day = info.ModTime().Format(dayFormat)
+		return nil
+	}
+	n, err := f.file.Write(f.header)
+	f.size += int64(n)
+	return err
+}
+
+func (f *File) shouldRotate(length int) bool {
+	if f.settings.Daily && f.now().Format(dayFormat) != f.day {
+		return true
+	}
+	if f.settings.MaxSizeInByte == 0 || f.size <= int64(len(f.header)) {
+		return false
+	}
+	return f.size+int64(length) > int64(f.settings.MaxSizeInByte)
+}
+
+func (f *File) rotate() error {
+	if err := f.close(); err != nil {
+		return err
+	}
+	rotated := f.rotatedName()
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	if f.settings.Compress {
+		if err := compress(rotated); err != nil {
+			return err
+		}
+	}
+	if err := f.removeExpired(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// removeExpired removes the oldest rotated files until MaxFiles are left
+func (f *File) removeExpired() error {
+	if f.settings.MaxFiles == 0 {
+		return nil
+	}
+	rotated, err := f.rotatedFiles()
+	if err != nil || len(rotated) <= int(f.settings.MaxFiles) {
+		return err
+	}
+	for _, name := range rotated[:len(rotated)-int(f.settings.MaxFiles)] {
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatedFiles returns the rotated files from the oldest to the newest
+func (f *File) rotatedFiles() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext) + "-"
+	matches, err := filepath.Glob(base + "????-??-??*")
+	if err != nil {
+		return nil, err
+	}
+	type rotatedFile struct {
+		name  string
+		day   string
+		index int
+	}
+	var files []rotatedFile
+	for _, name := range matches {
+		// name-YYYY-MM-DD[.N].ext[.gz]
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base), ".gz")
+		if !strings.HasSuffix(suffix, ext) {
+			continue
+		}
+		day, index, found := strings.Cut(strings.TrimSuffix(suffix, ext), ".")
+		file := rotatedFile{name: name, day: day}
+		if found {
+			if file.index, err = strconv.Atoi(index); err != nil {
+				continue
+			}
+		}
+		if _, err = time.Parse(dayFormat, day); err == nil {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].day != files[j].day {
+			return files[i].day < files[j].day
+		}
+		return files[i].index < files[j].index
+	})
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name
+	}
+	return names, nil
+}
+
+// rotatedName returns the first unused name in the form name-YYYY-MM-DD[.N].ext
+func (f *File) rotatedName() string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext) + "-" + f.day
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = base + "." + strconv.Itoa(i) + ext
+	}
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// compress replaces the file with a gzip compressed version of it
+func compress(name string) error {
+	source, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	if _, err = io.Copy(writer, source); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,129 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readGzip(t *testing.T, name string) string {
+	file, err := os.Open(name)
+	require.NoError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func Test_File_Write(t *testing.T) {
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		settings Settings
+		header   string
+		writes   []time.Time
+		files    map[string]string
+	}{
+		{name: "No rotation",
+			writes: []time.Time{day, day.AddDate(0, 0, 1)},
+			files:  map[string]string{"data.csv": "line\nline\n"},
+		},
+		{name: "Daily rotation with header",
+			settings: Settings{Daily: true},
+			header:   "header\n",
+			writes:   []time.Time{day, day.Add(time.Hour), day.AddDate(0, 0, 1)},
+			files: map[string]string{
+				"data-2023-06-01.csv": "header\nline\nline\n",
+				"data.csv":            "header\nline\n",
+			},
+		},
+		{name: "Size rotation",
+			settings: Settings{MaxSizeInByte: 10},
+			writes:   []time.Time{day, day, day, day, day},
+			files: map[string]string{
+				"data-2023-06-01.csv":   "line\nline\n",
+				"data-2023-06-01.1.csv": "line\nline\n",
+				"data.csv":              "line\n",
+			},
+		},
+		{name: "Daily rotation compressed",
+			settings: Settings{Daily: true, Compress: true},
+			writes:   []time.Time{day, day.AddDate(0, 0, 1)},
+			files: map[string]string{
+				"data-2023-06-01.csv.gz": "line\n",
+				"data.csv":               "line\n",
+			},
+		},
+		{name: "Retention",
+			settings: Settings{Daily: true, Compress: true, MaxFiles: 2},
+			writes:   []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), day.AddDate(0, 0, 3)},
+			files: map[string]string{
+				"data-2023-06-02.csv.gz": "line\n",
+				"data-2023-06-03.csv.gz": "line\n",
+				"data.csv":               "line\n",
+			},
+		},
+		{name: "Retention of size rotation",
+			settings: Settings{MaxSizeInByte: 5, MaxFiles: 2},
+			writes:   []time.Time{day, day, day, day},
+			files: map[string]string{
+				"data-2023-06-01.1.csv": "line\n",
+				"data-2023-06-01.2.csv": "line\n",
+				"data.csv":              "line\n",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			dir := t.TempDir()
+			now := test.writes[0]
+			file, err := openWithClock(filepath.Join(dir, "data.csv"), test.settings, []byte(test.header), func() time.Time { return now })
+			require.NoError(t, err, test.name)
+			for _, now = range test.writes {
+				_, err = file.Write([]byte("line\n"))
+				require.NoError(t, err, test.name)
+			}
+			require.NoError(t, file.Close(), test.name)
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err, test.name)
+			require.Len(t, entries, len(test.files), test.name)
+			for name, content := range test.files {
+				if filepath.Ext(name) == ".gz" {
+					require.Equal(t, content, readGzip(t, filepath.Join(dir, name)), test.name)
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				require.NoError(t, err, test.name)
+				require.Equal(t, content, string(data), test.name)
+			}
+		})
+	}
+}
+
+func Test_File_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "solar.log")
+	file, err := Open(path, Settings{}, nil)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.Write([]byte("before\n"))
+	require.NoError(t, err)
+	// logrotate moves the file away and signals the process to reopen it
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, file.Reopen())
+	_, err = file.Write([]byte("after\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "before\n", string(data))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(data))
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/scraper"
+)
+
+// ReplayResult counts the recordings of a replay
+type ReplayResult struct {
+	Failed  uint // Could not be read or were implausible
+	Written uint // Written, including the substituted ones
+	Dropped uint // Not written as there was nothing to substitute them with
+}
+
+// Replay passes the recordings through the plausibility check and the substitution like a polling window and writes them with their recorded time
+func Replay(recordings []scraper.Recording, settings Settings, metricsWriter influx.MetricsWriter, logger *slog.Logger) ReplayResult {
+	var result ReplayResult
+	checker := settings.Plausibility.NewChecker()
+	runStatus := status{}
+	for _, recording := range recordings {
+		runStatus.Current = recording.Metrics
+		err := recording.Err
+		if err == nil {
+			err = checker.Check(runStatus.Current, recording.Time)
+		}
+		if err != nil {
+			logger.Error("replayed response failed", "report_time", recording.Time, "error", err)
+			result.Failed++
+		}
+		if !runStatus.SubstituteCurrentStatus(err, settings.Scraper.MaxSustainedErrors) {
+			result.Dropped++
+			continue
+		}
+		if err = metricsWriter.Write(runStatus.Current, recording.Time, logger); err != nil {
+			logger.Error("writing metrics failed", "report_time", recording.Time, "error", err)
+			continue
+		}
+		result.Written++
+	}
+	return result
+}
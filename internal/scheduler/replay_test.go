@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/plausibility"
+	"solar-scraper/internal/scraper"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testMetricsWriter struct {
+	written []influx.SolarMetrics
+}
+
+func (w *testMetricsWriter) Ping() error { return nil }
+
+func (w *testMetricsWriter) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	w.written = append(w.written, metrics)
+	return nil
+}
+
+func Test_Replay(t *testing.T) {
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	parseErr := errors.New("string not found")
+	recordings := []scraper.Recording{
+		// Nothing to substitute the first failure with
+		{Time: day, Err: parseErr},
+		{Time: day.Add(time.Minute), Metrics: influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2}},
+		{Time: day.Add(2 * time.Minute), Err: parseErr},
+		// Implausible as the total decreased, dropped as only a single error is substituted
+		{Time: day.Add(3 * time.Minute), Metrics: influx.SolarMetrics{Now: 160, Today: 3.2, Total: 10}},
+		{Time: day.Add(4 * time.Minute), Metrics: influx.SolarMetrics{Now: 170, Today: 3.3, Total: 4756.4}},
+	}
+	settings := Settings{Plausibility: plausibility.Settings{Enabled: true, ResolutionInKWh: 0.1, ToleranceInPercents: 10}}
+	settings.Scraper.MaxSustainedErrors = 0
+	writer := &testMetricsWriter{}
+
+	result := Replay(recordings, settings, writer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Equal(t, ReplayResult{Failed: 3, Written: 3, Dropped: 2}, result)
+	require.Equal(t, []influx.SolarMetrics{
+		{Now: 150, Today: 3.1, Total: 4756.2},
+		{NowNil: true, Today: 3.1, Total: 4756.2},
+		{Now: 170, Today: 3.3, Total: 4756.4},
+	}, writer.written)
+}
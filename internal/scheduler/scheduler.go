@@ -2,53 +2,151 @@ package scheduler
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"solar-scraper/internal/alert"
+	"solar-scraper/internal/health"
 	"solar-scraper/internal/influx"
+	"solar-scraper/internal/plausibility"
 	"solar-scraper/internal/scraper"
 	"solar-scraper/internal/timer"
+	"sync"
 	"time"
 
 	"github.com/procyon-projects/chrono"
 )
 
-// Run starts the scheduler
-func Run(timeS timer.Settings, scraperS scraper.Settings, metricsWriter influx.MetricsWriter, debugLog, errorLog *log.Logger) {
-	end := timeS.GetEndTime()
-	start := timeS.GetStartTime()
+// Settings is the part of the configuration used by the scheduler, it can be updated while running
+type Settings struct {
+	Time         timer.Settings
+	Scraper      scraper.Settings
+	Summary      SummarySettings
+	Plausibility plausibility.Settings
+}
+
+// Run starts the scheduler, settings received on updates are applied to the running scheduler.
+// The substitution state and the summary are kept as long as the start of the polling window does not change.
+func Run(settings Settings, metricsWriter influx.MetricsWriter, tracker *health.Tracker, alerts *alert.Engine, updates <-chan Settings, logger *slog.Logger) {
+	// mutex guards the settings and the state shared with the running task
+	var mutex sync.Mutex
+	checker := settings.Plausibility.NewChecker()
+	// apply returns true when the polling window or interval changed, the running task is only rescheduled then
+	apply := func(next Settings) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if next.Plausibility != settings.Plausibility {
+			checker = next.Plausibility.NewChecker()
+		}
+		reschedule := next.Time != settings.Time
+		settings = next
+		return reschedule
+	}
+
+	runStatus := status{}
+	var windowSummary *summary
+	var windowStart time.Time
+	// leaveWindow writes the summary of the window that was left
+	leaveWindow := func(pointTime time.Time) {
+		if windowSummary == nil {
+			return
+		}
+		if err := settings.Summary.write(metricsWriter, windowSummary, pointTime); err != nil {
+			logger.Error("writing the daily summary failed", "error", err)
+		}
+		windowSummary = nil
+	}
 
-	credentials := scraper.EncodeCredentials(scraperS.Username, scraperS.Password)
-	pollingInterval := time.Duration(timeS.PollingIntervalInSeconds) * time.Second
 	for {
+		end := settings.Time.GetEndTime()
+		start := settings.Time.GetStartTime()
+		pollingInterval := time.Duration(settings.Time.PollingIntervalInSeconds) * time.Second
 		currentTime := time.Now()
 		startTime := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), start.Hour(), start.Minute(), start.Second(), 0, currentTime.Location())
 		endTime := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), end.Hour(), end.Minute(), end.Second(), 0, currentTime.Location())
 		nextStartTime := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day()+1, start.Hour(), start.Minute(), start.Second(), 0, currentTime.Location())
 		if currentTime.Before(startTime) {
 			// if current time is before start time wait till start time
-			time.Sleep(startTime.Sub(currentTime))
+			leaveWindow(currentTime)
+			tracker.SetWindow(startTime, endTime)
+			tracker.SetNextRun(startTime)
+			wait(startTime.Sub(currentTime), updates, apply)
+			continue
 		} else if currentTime.After(endTime) {
 			// if current time is after end time wait till next start time
-			time.Sleep(nextStartTime.Sub(currentTime))
+			leaveWindow(endTime)
+			tracker.SetWindow(nextStartTime, endTime.AddDate(0, 0, 1))
+			tracker.SetNextRun(nextStartTime)
+			wait(nextStartTime.Sub(currentTime), updates, apply)
 			continue
 		}
+		tracker.SetWindow(startTime, endTime)
+		if !startTime.Equal(windowStart) {
+			leaveWindow(currentTime)
+			windowStart = startTime
+			alerts.StartWindow()
+			runStatus = status{}
+			windowSummary = &summary{}
+		}
 
-		runStatus := status{}
-		var err error
-		var reportingTime time.Time
 		task, _ := chrono.NewDefaultTaskScheduler().ScheduleAtFixedRate(func(ctx context.Context) {
-			runStatus.Current, reportingTime, err = scraper.GetMetrics(scraperS.URL, credentials, scraperS.Retry)
+			mutex.Lock()
+			defer mutex.Unlock()
+			scrapeStart := time.Now()
+			inverterLogger := logger.With("inverter", settings.Scraper.URL)
+			credentials := scraper.EncodeCredentials(settings.Scraper.Username, settings.Scraper.Password)
+			current, reportingTime, attempts, err := scraper.GetMetrics(settings.Scraper.URL, credentials, settings.Scraper.Retry, settings.Scraper.NewRecorder(), inverterLogger)
+			runStatus.Current = current
+			if err == nil {
+				// implausible readings are handled like failed scrapes, so they get substituted
+				err = checker.Check(runStatus.Current, reportingTime)
+			}
 			if err != nil {
-				errorLog.Println(err)
+				inverterLogger.Error("scrape failed", "attempts", attempts, "error", err)
+			}
+			scrapeTime := time.Now()
+			windowSummary.observeScrape(err)
+			tracker.ObserveScrape(err, scrapeTime, scrapeTime.Sub(scrapeStart), attempts)
+			if alertErr := alerts.Evaluate(runStatus.Current, err, scrapeTime); alertErr != nil {
+				inverterLogger.Error("sending the alert failed", "error", alertErr)
+			}
+			tracker.SetNextRun(scrapeTime.Add(pollingInterval))
+			if observer, ok := metricsWriter.(influx.ScrapeObserver); ok {
+				observer.ObserveScrape(err, scrapeTime)
 			}
-			if runStatus.SubstituteCurrentStatus(err, scraperS.MaxSustainedErrors) {
-				if err = metricsWriter.Write(runStatus.Current, reportingTime, debugLog); err != nil {
-					errorLog.Println(err)
+			if runStatus.SubstituteCurrentStatus(err, settings.Scraper.MaxSustainedErrors) {
+				if err = metricsWriter.Write(runStatus.Current, reportingTime, inverterLogger); err != nil {
+					inverterLogger.Error("writing metrics failed", "error", err)
 				}
+				tracker.ObserveWrite(runStatus.Current, reportingTime, err)
+				windowSummary.observeWrite(runStatus.Current, reportingTime)
+			} else {
+				tracker.ObserveDropped()
+			}
+			if err = tracker.WriteInstrumentation(metricsWriter, scrapeTime); err != nil {
+				inverterLogger.Error("writing instrumentation failed", "error", err)
 			}
 		}, pollingInterval)
 		// if current time is after start time and before end time
-		time.Sleep(time.Until(endTime))
+		wait(time.Until(endTime), updates, apply)
 		task.Cancel()
+		// the task might still be running, wait for it before the window is evaluated again
+		mutex.Lock()
+		mutex.Unlock()
+	}
+}
+
+// wait sleeps for the duration and applies the settings received on updates, it returns early when apply requests a reschedule
+func wait(duration time.Duration, updates <-chan Settings, apply func(Settings) bool) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case next := <-updates:
+			if apply(next) {
+				return
+			}
+		}
 	}
 }
 
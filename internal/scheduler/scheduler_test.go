@@ -3,7 +3,9 @@ package scheduler
 import (
 	"errors"
 	"solar-scraper/internal/influx"
+	"solar-scraper/internal/scraper"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -120,3 +122,25 @@ func Test_Status_SubstituteCurrentStatus(t *testing.T) {
 		})
 	}
 }
+
+func Test_wait(t *testing.T) {
+	updates := make(chan Settings, 1)
+	var applied []Settings
+	apply := func(next Settings) bool {
+		applied = append(applied, next)
+		return next.Scraper.Retry == 2
+	}
+
+	// Settings that do not need a reschedule are applied while waiting
+	updates <- Settings{}
+	start := time.Now()
+	wait(50*time.Millisecond, updates, apply)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Len(t, applied, 1)
+
+	updates <- Settings{Scraper: scraper.Settings{Retry: 2}}
+	start = time.Now()
+	wait(time.Minute, updates, apply)
+	require.Less(t, time.Since(start), time.Minute)
+	require.Len(t, applied, 2)
+}
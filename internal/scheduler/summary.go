@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyMeasurement string = "empty measurement"
+)
+
+// Fields of the daily summary point
+const (
+	summaryYieldToday      string = "YieldToday"
+	summaryPeakPower       string = "PeakPower"
+	summaryPeakPowerTime   string = "PeakPowerTime"
+	summaryFirstProduction string = "FirstProduction"
+	summaryLastProduction  string = "LastProduction"
+	summarySamples         string = "Samples"
+	summarySubstituted     string = "SubstitutedSamples"
+	summaryScrapeFailures  string = "ScrapeFailures"
+)
+
+// SummarySettings is the configuration for the daily summary written at the end of every polling window
+type SummarySettings struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Measurement string `mapstructure:"measurement"`
+}
+
+// Defaults sets the default values for the settings
+func (s SummarySettings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".enabled", true)
+	v.SetDefault(setting+".measurement", "DailySummary")
+}
+
+// Validate checks if the settings are valid
+func (s SummarySettings) Validate() error {
+	if s.Enabled && s.Measurement == "" {
+		return validation.New("measurement", ErrorEmptyMeasurement)
+	}
+	return nil
+}
+
+// write writes the summary to the writer when enabled and supported by the writer
+func (s SummarySettings) write(writer influx.MetricsWriter, sum *summary, pointTime time.Time) error {
+	pointWriter, ok := writer.(influx.PointWriter)
+	if !s.Enabled || !ok {
+		return nil
+	}
+	return pointWriter.WritePoint(s.Measurement, sum.fields(), pointTime)
+}
+
+// summary collects the statistics of a single polling window
+type summary struct {
+	mutex           sync.Mutex
+	today           float64
+	peakPower       uint
+	peakPowerTime   time.Time
+	firstProduction time.Time
+	lastProduction  time.Time
+	samples         uint
+	substituted     uint
+	scrapeFailures  uint
+}
+
+// observeScrape records the result of a scrape
+func (s *summary) observeScrape(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.scrapeFailures++
+	s.mutex.Unlock()
+}
+
+// observeWrite records a point that was written, substituted points have no current power
+func (s *summary) observeWrite(metrics influx.SolarMetrics, reportTime time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samples++
+	s.today = metrics.Today
+	if metrics.NowNil {
+		s.substituted++
+		return
+	}
+	if metrics.Now == 0 {
+		return
+	}
+	if metrics.Now > s.peakPower {
+		s.peakPower = metrics.Now
+		s.peakPowerTime = reportTime
+	}
+	if s.firstProduction.IsZero() {
+		s.firstProduction = reportTime
+	}
+	s.lastProduction = reportTime
+}
+
+// fields returns the summary as fields, the production times are left out when nothing was produced
+func (s *summary) fields() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fields := map[string]interface{}{
+		summaryYieldToday:     s.today,
+		summaryPeakPower:      s.peakPower,
+		summarySamples:        s.samples,
+		summarySubstituted:    s.substituted,
+		summaryScrapeFailures: s.scrapeFailures,
+	}
+	if !s.firstProduction.IsZero() {
+		fields[summaryPeakPowerTime] = s.peakPowerTime.Unix()
+		fields[summaryFirstProduction] = s.firstProduction.Unix()
+		fields[summaryLastProduction] = s.lastProduction.Unix()
+	}
+	return fields
+}
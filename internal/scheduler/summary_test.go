@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"errors"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPointWriter struct {
+	measurement string
+	fields      map[string]interface{}
+	pointTime   time.Time
+}
+
+func (w *testPointWriter) Ping() error { return nil }
+
+func (w *testPointWriter) Write(influx.SolarMetrics, time.Time, *slog.Logger) error { return nil }
+
+func (w *testPointWriter) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error {
+	w.measurement = measurement
+	w.fields = fields
+	w.pointTime = pointTime
+	return nil
+}
+
+func Test_summary_fields(t *testing.T) {
+	type scrape struct {
+		minutes int
+		err     error
+		metrics *influx.SolarMetrics
+	}
+	start := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	tests := []struct {
+		name    string
+		scrapes []scrape
+		output  map[string]interface{}
+	}{
+		{name: "No production",
+			scrapes: []scrape{
+				{minutes: 0, metrics: &influx.SolarMetrics{Today: 0, Total: 100}},
+				{minutes: 1, err: errors.New("test error")},
+			},
+			output: map[string]interface{}{
+				summaryYieldToday:     float64(0),
+				summaryPeakPower:      uint(0),
+				summarySamples:        uint(1),
+				summarySubstituted:    uint(0),
+				summaryScrapeFailures: uint(1),
+			},
+		},
+		{name: "Production with substitution",
+			scrapes: []scrape{
+				{minutes: 0, metrics: &influx.SolarMetrics{Now: 0, Today: 0}},
+				{minutes: 1, metrics: &influx.SolarMetrics{Now: 100, Today: 0.1}},
+				{minutes: 2, metrics: &influx.SolarMetrics{Now: 300, Today: 0.2}},
+				{minutes: 3, err: errors.New("test error"), metrics: &influx.SolarMetrics{NowNil: true, Today: 0.2}},
+				{minutes: 4, metrics: &influx.SolarMetrics{Now: 200, Today: 0.3}},
+				{minutes: 5, metrics: &influx.SolarMetrics{Now: 0, Today: 0.3}},
+			},
+			output: map[string]interface{}{
+				summaryYieldToday:      0.3,
+				summaryPeakPower:       uint(300),
+				summaryPeakPowerTime:   at(2).Unix(),
+				summaryFirstProduction: at(1).Unix(),
+				summaryLastProduction:  at(4).Unix(),
+				summarySamples:         uint(6),
+				summarySubstituted:     uint(1),
+				summaryScrapeFailures:  uint(1),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			sum := &summary{}
+			for _, s := range test.scrapes {
+				sum.observeScrape(s.err)
+				if s.metrics != nil {
+					sum.observeWrite(*s.metrics, at(s.minutes))
+				}
+			}
+			require.Equal(t, test.output, sum.fields(), test.name)
+		})
+	}
+}
+
+func Test_SummarySettings_write(t *testing.T) {
+	endTime := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+	writer := &testPointWriter{}
+	require.NoError(t, SummarySettings{Enabled: false, Measurement: "DailySummary"}.write(writer, &summary{}, endTime))
+	require.Nil(t, writer.fields)
+	require.NoError(t, SummarySettings{Enabled: true, Measurement: "DailySummary"}.write(writer, &summary{samples: 3}, endTime))
+	require.Equal(t, "DailySummary", writer.measurement)
+	require.Equal(t, endTime, writer.pointTime)
+	require.Equal(t, uint(3), writer.fields[summarySamples])
+}
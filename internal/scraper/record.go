@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"solar-scraper/internal/influx"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name of a recorded response, the time is the reporting time in UTC
+const (
+	recordPrefix     string = "status-"
+	recordSuffix     string = ".html"
+	recordTimeFormat string = "20060102T150405.000000Z"
+)
+
+// Recorder saves the raw responses of the inverter to a directory, a nil Recorder saves nothing
+type Recorder struct {
+	directory string
+}
+
+// NewRecorder creates the recorder, nil is returned when recording is disabled
+func (s Settings) NewRecorder() *Recorder {
+	if s.Record == "" {
+		return nil
+	}
+	return &Recorder{directory: s.Record}
+}
+
+// save writes the response to a file named after the reporting time
+func (r *Recorder) save(body []byte, reportingTime time.Time) error {
+	if r == nil {
+		return nil
+	}
+	if err := os.MkdirAll(r.directory, 0755); err != nil {
+		return err
+	}
+	name := recordPrefix + reportingTime.UTC().Format(recordTimeFormat) + recordSuffix
+	return os.WriteFile(filepath.Join(r.directory, name), body, 0644)
+}
+
+// Recording is a recorded response with the metrics extracted from it
+type Recording struct {
+	Time    time.Time
+	Metrics influx.SolarMetrics
+	Err     error // Error of the extraction, the response was received but could not be read
+}
+
+// ReadRecordings extracts the metrics of every recorded response in the directory, ordered by time.
+// Files that are not named like recorded responses are ignored, so a fixture like test/data/sample.html can be renamed to be replayed.
+func ReadRecordings(directory string) ([]Recording, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var recordings []Recording
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, recordPrefix) || !strings.HasSuffix(name, recordSuffix) {
+			continue
+		}
+		reportingTime, err := time.Parse(recordTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, recordPrefix), recordSuffix))
+		if err != nil {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(directory, name))
+		if err != nil {
+			return nil, err
+		}
+		recording := Recording{Time: reportingTime.Local()}
+		recording.Metrics, recording.Err = extractStatusValues(body)
+		recordings = append(recordings, recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].Time.Before(recordings[j].Time) })
+	return recordings, nil
+}
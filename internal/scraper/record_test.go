@@ -0,0 +1,73 @@
+package scraper
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GetMetrics_Record(t *testing.T) {
+	sample, err := os.ReadFile("../../test/data/sample.html")
+	require.NoError(t, err)
+	responses := [][]byte{[]byte("<html>firmware update</html>"), sample}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(responses[0])
+		responses = responses[1:]
+	}))
+	defer server.Close()
+	directory := filepath.Join(t.TempDir(), "recordings")
+	recorder := Settings{Record: directory}.NewRecorder()
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The unreadable response of the first attempt is recorded as well
+	metrics, reportingTime, attempts, err := GetMetrics(server.URL, EncodeCredentials("admin", "admin"), 1, recorder, discard)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), attempts)
+
+	recordings, err := ReadRecordings(directory)
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+	require.Equal(t, errorSearchKeyNotFound(now), recordings[0].Err)
+	require.NoError(t, recordings[1].Err)
+	require.Equal(t, metrics, recordings[1].Metrics)
+	require.True(t, reportingTime.Truncate(time.Microsecond).Equal(recordings[1].Time))
+}
+
+func Test_ReadRecordings(t *testing.T) {
+	directory := t.TempDir()
+	sample, err := os.ReadFile("../../test/data/sample.html")
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"status-20230601T120100.000000Z.html": []byte(`var webdata_now_p = "200"; var webdata_today_e = "3.2"; var webdata_total_e = "4756.3";`),
+		"status-20230601T120000.000000Z.html": sample,
+		"sample.html":                         sample,
+		"status-yesterday.html":               sample,
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(directory, name), data, 0644))
+	}
+	recordings, err := ReadRecordings(directory)
+	require.NoError(t, err)
+	require.Equal(t, []Recording{
+		{Time: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC).Local(), Metrics: influx.SolarMetrics{Now: 150, Today: 3.10, Total: 4756.2}},
+		{Time: time.Date(2023, 6, 1, 12, 1, 0, 0, time.UTC).Local(), Metrics: influx.SolarMetrics{Now: 200, Today: 3.2, Total: 4756.3}},
+	}, recordings)
+
+	_, err = ReadRecordings(filepath.Join(directory, "missing"))
+	require.Error(t, err)
+}
+
+func Test_NewRecorder(t *testing.T) {
+	require.Nil(t, Settings{}.NewRecorder())
+	// A nil recorder saves nothing
+	var recorder *Recorder
+	require.NoError(t, recorder.save([]byte("body"), time.Now()))
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"log/slog"
 	"math"
 	"net/http"
 	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
 	"strconv"
 	"time"
 
@@ -18,6 +20,7 @@ const (
 	now           string = `var webdata_now_p = "`
 	today         string = `var webdata_today_e = "`
 	total         string = `var webdata_total_e = "`
+	alarm         string = `var webdata_alarm = "`
 	ErrorEmptyUrl string = "empty url"
 )
 
@@ -37,6 +40,11 @@ func extractStatusValues(body []byte) (stats influx.SolarMetrics, err error) {
 		return
 	}
 	stats.Total, err = getValue(body, total)
+	if err != nil {
+		return
+	}
+	// Not all firmware versions report alarms, so a missing alarm is not an error
+	stats.Alarm, _ = getString(body, alarm)
 	return
 }
 
@@ -44,18 +52,21 @@ func errorSearchKeyNotFound(search string) error {
 	return errors.New("string (" + search + ") not found")
 }
 
-// GetStatus gets the metrics data from the url
-func GetMetrics(url string, encoded credentials, retry uint) (stats influx.SolarMetrics, reportingTime time.Time, err error) {
+// GetMetrics gets the metrics data from the url, attempts is the number of requests made including retries.
+// Every received response is saved by the recorder. Every failed attempt is logged at debug level, the caller handles the final error.
+func GetMetrics(url string, encoded credentials, retry uint, recorder *Recorder, logger *slog.Logger) (stats influx.SolarMetrics, reportingTime time.Time, attempts uint, err error) {
 	for i := -1; i < int(retry); i++ {
-		stats, reportingTime, err = retryStatus(url, encoded)
+		attempts++
+		stats, reportingTime, err = retryStatus(url, encoded, recorder, logger)
 		if err == nil {
 			break
 		}
+		logger.Debug("scrape attempt failed", "attempt", attempts, "error", err)
 	}
 	return
 }
 
-func retryStatus(url string, encoded credentials) (stats influx.SolarMetrics, reportingTime time.Time, err error) {
+func retryStatus(url string, encoded credentials, recorder *Recorder, logger *slog.Logger) (stats influx.SolarMetrics, reportingTime time.Time, err error) {
 	var resp *http.Response
 	client := &http.Client{}
 	req, _ := http.NewRequest("GET", url, nil)
@@ -68,23 +79,35 @@ func retryStatus(url string, encoded credentials) (stats influx.SolarMetrics, re
 	reportingTime = time.Now()
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
+	// A failed recording must not fail the scrape
+	if recordErr := recorder.save(body, reportingTime); recordErr != nil {
+		logger.Warn("recording the response failed", "error", recordErr)
+	}
 	stats, err = extractStatusValues(body)
 	return
 }
 
 func getValue(body []byte, search string) (float64, error) {
+	value, err := getString(body, search)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func getString(body []byte, search string) (string, error) {
 	split := bytes.SplitAfter(body, []byte(search))
 	if len(split) < 2 {
-		return 0, errorSearchKeyNotFound(search)
+		return "", errorSearchKeyNotFound(search)
 	}
-	numberAsByte := []byte{}
+	valueAsByte := []byte{}
 	for i, e := range split[1] {
 		if e == '"' {
-			numberAsByte = split[1][:i]
+			valueAsByte = split[1][:i]
 			break
 		}
 	}
-	return strconv.ParseFloat(string(numberAsByte), 64)
+	return string(valueAsByte), nil
 }
 
 type credentials string
@@ -92,22 +115,24 @@ type credentials string
 // Settings contains the settings for the scraper
 type Settings struct {
 	MaxSustainedErrors uint   `mapstructure:"sustained_errors"` // The amount of consecutive errors that are applicable for a status substitution. If this value is exceeded nothing wil be written to the database, until valid data is received.
-	Password           string `mapstructure:"password"`
+	Password           string `mapstructure:"password" secret:"true"`
+	Record             string `mapstructure:"record"` // Directory the raw responses are saved to, empty disables recording
 	Retry              uint   `mapstructure:"retry"`
 	URL                string `mapstructure:"url"`
 	Username           string `mapstructure:"username"`
 }
 
 // Defaults sets the default values for the settings
-func (s Settings) Defaults(setting string) {
-	viper.SetDefault(setting+".sustained_errors", uint(5))
-	viper.SetDefault(setting+".retry", uint(2))
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".sustained_errors", uint(5))
+	v.SetDefault(setting+".retry", uint(2))
 }
 
 // Validate checks if the settings are valid
 func (s Settings) Validate() error {
+	var errs []error
 	if s.URL == "" {
-		return errors.New(ErrorEmptyUrl)
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
 	}
-	return nil
+	return errors.Join(errs...)
 }
@@ -60,6 +60,12 @@ func Test_extractStatusValues(t *testing.T) {
 			},
 			output: testOutput{stats: influx.SolarMetrics{Now: 150, Today: 3.10, Total: 4756.2}},
 		},
+		{name: "Valid alarm",
+			input: func() []byte {
+				return []byte(`var webdata_now_p = "0"; var webdata_today_e = "123.45"; var webdata_total_e = "1234.56"; var webdata_alarm = "F07";`)
+			},
+			output: testOutput{stats: influx.SolarMetrics{Today: 123.45, Total: 1234.56, Alarm: "F07"}},
+		},
 		{name: "Error no now",
 			input: func() []byte {
 				return []byte(`var webdata_today_e = "123.45"; var webdata_total_e = "1234.56";`)
@@ -99,12 +105,17 @@ func Test_Validate(t *testing.T) {
 		},
 		{name: "ErrorEmptyUrl",
 			input:  Settings{},
-			output: errors.New(ErrorEmptyUrl),
+			output: errors.New("url: " + ErrorEmptyUrl),
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(*testing.T) {
-			require.Equal(t, test.output, test.input.Validate(), test.name)
+			err := test.input.Validate()
+			if test.output == nil {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output.Error(), test.name)
+			}
 		})
 	}
 }
@@ -0,0 +1,491 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"solar-scraper/internal/file"
+	"solar-scraper/internal/graphite"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/mqtt"
+	"solar-scraper/internal/postgres"
+	"solar-scraper/internal/prometheus"
+	"solar-scraper/internal/pvoutput"
+	"solar-scraper/internal/sqlite"
+	"solar-scraper/internal/validation"
+	"solar-scraper/internal/webhook"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyType   string = "empty type"
+	ErrorInvalidType string = "invalid type"
+	ErrorNoSinks     string = "no sinks configured"
+	ErrorNoWriters   string = "no sink could be created"
+)
+
+const (
+	// TypeFile appends the metrics to a CSV or JSON-lines file
+	TypeFile string = "file"
+	// TypeGraphite sends the metrics with the Graphite plaintext protocol
+	TypeGraphite string = "graphite"
+	// TypeInfluxDB writes the metrics to an InfluxDB v1 or v2 server
+	TypeInfluxDB string = "influxdb"
+	// TypeMQTT publishes the metrics to an MQTT broker with Home Assistant discovery
+	TypeMQTT string = "mqtt"
+	// TypePostgres upserts the metrics into a PostgreSQL or TimescaleDB table
+	TypePostgres string = "postgres"
+	// TypePrometheus exposes the latest metrics on an HTTP endpoint for Prometheus
+	TypePrometheus string = "prometheus"
+	// TypePVOutput uploads the metrics as status intervals to PVOutput.org
+	TypePVOutput string = "pvoutput"
+	// TypeSQLite stores the metrics and daily summaries in a local SQLite database
+	TypeSQLite string = "sqlite"
+	// TypeStatsD sends the metrics as StatsD gauges
+	TypeStatsD string = "statsd"
+	// TypeWebhook sends the metrics to an HTTP endpoint with a templated body
+	TypeWebhook string = "webhook"
+)
+
+// Settings is the configuration for a single sink
+type Settings struct {
+	Type       string                  `mapstructure:"type"`
+	File       file.Settings           `mapstructure:"file"`
+	Graphite   graphite.Settings       `mapstructure:"graphite"`
+	InfluxDB   influx.Settings         `mapstructure:"influxdb"`
+	MQTT       mqtt.Settings           `mapstructure:"mqtt"`
+	Postgres   postgres.Settings       `mapstructure:"postgres"`
+	Prometheus prometheus.Settings     `mapstructure:"prometheus"`
+	PVOutput   pvoutput.Settings       `mapstructure:"pvoutput"`
+	SQLite     sqlite.Settings         `mapstructure:"sqlite"`
+	StatsD     graphite.StatsDSettings `mapstructure:"statsd"`
+	Webhook    webhook.Settings        `mapstructure:"webhook"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	s.File.Defaults(v, setting+".file")
+	s.Graphite.Defaults(v, setting+".graphite")
+	s.InfluxDB.Defaults(v, setting+".influxdb")
+	s.MQTT.Defaults(v, setting+".mqtt")
+	s.Postgres.Defaults(v, setting+".postgres")
+	s.Prometheus.Defaults(v, setting+".prometheus")
+	s.PVOutput.Defaults(v, setting+".pvoutput")
+	s.SQLite.Defaults(v, setting+".sqlite")
+	s.StatsD.Defaults(v, setting+".statsd")
+	s.Webhook.Defaults(v, setting+".webhook")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var err error
+	switch s.Type {
+	case "":
+		return validation.New("type", ErrorEmptyType)
+	case TypeFile:
+		err = s.File.Validate()
+	case TypeGraphite:
+		err = s.Graphite.Validate()
+	case TypeInfluxDB:
+		err = s.InfluxDB.Validate()
+	case TypeMQTT:
+		err = s.MQTT.Validate()
+	case TypePostgres:
+		err = s.Postgres.Validate()
+	case TypePrometheus:
+		err = s.Prometheus.Validate()
+	case TypePVOutput:
+		err = s.PVOutput.Validate()
+	case TypeSQLite:
+		err = s.SQLite.Validate()
+	case TypeStatsD:
+		err = s.StatsD.Validate()
+	case TypeWebhook:
+		err = s.Webhook.Validate()
+	default:
+		return validation.New("type", ErrorInvalidType)
+	}
+	// The settings of every type are in the field named after the type
+	return validation.Field(s.Type, err)
+}
+
+// CreateWriter creates a MetricsWriter based on the type of the sink
+func (s Settings) CreateWriter() (influx.MetricsWriter, error) {
+	switch s.Type {
+	case TypeFile:
+		return s.File.CreateWriter()
+	case TypeGraphite:
+		return s.Graphite.CreateWriter(), nil
+	case TypeInfluxDB:
+		return s.InfluxDB.CreateWriter(), nil
+	case TypeMQTT:
+		return s.MQTT.CreateWriter(), nil
+	case TypePostgres:
+		return s.Postgres.CreateWriter()
+	case TypePrometheus:
+		return s.Prometheus.CreateWriter()
+	case TypePVOutput:
+		return s.PVOutput.CreateWriter(), nil
+	case TypeSQLite:
+		return s.SQLite.CreateWriter()
+	case TypeStatsD:
+		return s.StatsD.CreateWriter(), nil
+	case TypeWebhook:
+		return s.Webhook.CreateWriter()
+	}
+	return nil, errors.New(ErrorInvalidType)
+}
+
+// History checks if the sink stores metrics with their report time, the other sinks only keep or publish the current state
+func (s Settings) History() bool {
+	switch s.Type {
+	case TypeMQTT, TypePrometheus, TypeStatsD, TypeWebhook:
+		return false
+	}
+	return true
+}
+
+// Collection contains all the configured sinks by name
+type Collection map[string]Settings
+
+// Defaults sets the default values for every sink present in the config
+func (c Collection) Defaults(v *viper.Viper, setting string) {
+	for name := range v.GetStringMap(setting) {
+		Settings{}.Defaults(v, setting+"."+name)
+	}
+}
+
+// Validate checks if all the sinks are valid
+func (c Collection) Validate() error {
+	if len(c) == 0 {
+		return errors.New(ErrorNoSinks)
+	}
+	errs := make([]error, 0, len(c))
+	for _, name := range c.Names() {
+		errs = append(errs, validation.Field(name, c[name].Validate()))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter creates a single MetricsWriter that writes to every sink
+func (c Collection) CreateWriter() (*Multi, error) {
+	multi := &Multi{}
+	for _, name := range c.Names() {
+		writer, err := c[name].CreateWriter()
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		multi.Add(name, writer)
+	}
+	return multi, nil
+}
+
+// Open creates a single MetricsWriter like CreateWriter and pings every sink. A sink that can not be created is logged
+// and created again on every write or ping until that succeeds. A sink that is not reachable is logged and kept, its writes fail until it is reachable.
+// An error is only returned when no sink could be created.
+func (c Collection) Open(logger *slog.Logger) (*Multi, error) {
+	multi := &Multi{}
+	created := 0
+	for _, name := range c.Names() {
+		writer, err := c[name].CreateWriter()
+		if err != nil {
+			// The sink is created later, on the first write or ping that succeeds
+			logger.Error("creating sink failed", "sink", name, "error", err)
+			multi.Add(name, &pendingWriter{settings: c[name]})
+			continue
+		}
+		multi.Add(name, writer)
+		created++
+	}
+	if created == 0 {
+		multi.Close()
+		return nil, errors.New(ErrorNoWriters)
+	}
+	multi.each(func(name string, writer influx.MetricsWriter) error {
+		if _, ok := writer.(*pendingWriter); ok {
+			return nil
+		}
+		if err := writer.Ping(); err != nil {
+			logger.Warn("sink not reachable", "sink", name, "error", err)
+		}
+		return nil
+	}, false)
+	return multi, nil
+}
+
+// First returns the name and settings of the first sink of the given type, ordered by name
+func (c Collection) First(sinkType string) (string, Settings, bool) {
+	for _, name := range c.Names() {
+		if c[name].Type == sinkType {
+			return name, c[name], true
+		}
+	}
+	return "", Settings{}, false
+}
+
+// Names returns the names of the sinks in alphabetical order
+func (c Collection) Names() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type namedWriter struct {
+	name   string
+	writer influx.MetricsWriter
+}
+
+// WriteObserver is called after every write to a sink
+type WriteObserver func(name string, duration time.Duration, err error)
+
+// Multi is a MetricsWriter that writes to multiple sinks, a failing sink does not prevent the others from being written
+type Multi struct {
+	mutex    sync.RWMutex
+	writers  []namedWriter
+	observer WriteObserver
+}
+
+// SetObserver sets the function that is informed about the duration and result of every write to a sink
+func (m *Multi) SetObserver(observer WriteObserver) {
+	m.observer = observer
+}
+
+// Add adds a sink to the writer
+func (m *Multi) Add(name string, writer influx.MetricsWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writers = append(m.writers, namedWriter{name: name, writer: writer})
+}
+
+// Update replaces the sinks whose settings changed between previous and next, unchanged sinks keep their connections and state.
+// Changed and removed sinks are closed before the new ones are created, so a listener can be reused.
+// When a sink can not be created the previous sinks are restored and the error is returned.
+func (m *Multi) Update(previous, next Collection) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	kept := make([]namedWriter, 0, len(m.writers))
+	for _, w := range m.writers {
+		if settings, ok := next[w.name]; ok && reflect.DeepEqual(settings, previous[w.name]) {
+			kept = append(kept, w)
+			continue
+		}
+		closeWriter(w.writer)
+	}
+	writers, err := createMissing(kept, next)
+	if err == nil {
+		m.writers = writers
+		return nil
+	}
+	for _, w := range writers[len(kept):] {
+		closeWriter(w.writer)
+	}
+	restored, restoreErr := createMissing(kept, previous)
+	m.writers = restored
+	return errors.Join(err, restoreErr)
+}
+
+// createMissing creates the sinks of the collection that are not in writers, ordered by name after the existing writers
+func createMissing(writers []namedWriter, c Collection) ([]namedWriter, error) {
+	existing := make(map[string]bool, len(writers))
+	for _, w := range writers {
+		existing[w.name] = true
+	}
+	for _, name := range c.Names() {
+		if existing[name] {
+			continue
+		}
+		writer, err := c[name].CreateWriter()
+		if err != nil {
+			return writers, fmt.Errorf("sink %s: %w", name, err)
+		}
+		writers = append(writers, namedWriter{name: name, writer: writer})
+	}
+	return writers, nil
+}
+
+// Close closes every sink that holds a connection, file or listener
+func (m *Multi) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	errs := make([]error, 0, len(m.writers))
+	for _, w := range m.writers {
+		if err := closeWriter(w.writer); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", w.name, err))
+		}
+	}
+	m.writers = nil
+	return errors.Join(errs...)
+}
+
+func closeWriter(writer influx.MetricsWriter) error {
+	if closer, ok := writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// pendingWriter stands in for a sink that could not be created, every write and ping tries to create it again
+type pendingWriter struct {
+	mutex    sync.Mutex
+	settings Settings
+	writer   influx.MetricsWriter
+}
+
+// get returns the sink, it is created when it does not exist yet
+func (p *pendingWriter) get() (influx.MetricsWriter, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.writer == nil {
+		writer, err := p.settings.CreateWriter()
+		if err != nil {
+			return nil, err
+		}
+		p.writer = writer
+	}
+	return p.writer, nil
+}
+
+func (p *pendingWriter) Ping() error {
+	writer, err := p.get()
+	if err != nil {
+		return err
+	}
+	return writer.Ping()
+}
+
+func (p *pendingWriter) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	writer, err := p.get()
+	if err != nil {
+		return err
+	}
+	return writer.Write(metrics, reportTime, logger)
+}
+
+func (p *pendingWriter) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error {
+	writer, err := p.get()
+	if err != nil {
+		return err
+	}
+	if pointWriter, ok := writer.(influx.PointWriter); ok {
+		return pointWriter.WritePoint(measurement, fields, pointTime)
+	}
+	return nil
+}
+
+func (p *pendingWriter) HasPoint(reportTime time.Time) (bool, error) {
+	writer, err := p.get()
+	if err != nil {
+		return false, err
+	}
+	if checker, ok := writer.(influx.PointChecker); ok {
+		return checker.HasPoint(reportTime)
+	}
+	return false, nil
+}
+
+// ObserveScrape is passed on once the sink exists, observing a scrape does not create it
+func (p *pendingWriter) ObserveScrape(err error, scrapeTime time.Time) {
+	p.mutex.Lock()
+	writer := p.writer
+	p.mutex.Unlock()
+	if observer, ok := writer.(influx.ScrapeObserver); ok {
+		observer.ObserveScrape(err, scrapeTime)
+	}
+}
+
+func (p *pendingWriter) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.writer == nil {
+		return nil
+	}
+	return closeWriter(p.writer)
+}
+
+// Ping checks if every sink is reachable
+func (m *Multi) Ping() error {
+	return m.each(func(_ string, writer influx.MetricsWriter) error {
+		return writer.Ping()
+	}, false)
+}
+
+// Write writes the metrics to every sink, the logger passed to a sink has the name of the sink as attribute
+func (m *Multi) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	return m.each(func(name string, writer influx.MetricsWriter) error {
+		return writer.Write(metrics, reportTime, logger.With("sink", name))
+	}, true)
+}
+
+// WriteMissing writes the metrics to every sink that does not have them yet, sinks that do not implement influx.PointChecker always get them.
+// written is the number of sinks the metrics were written to.
+func (m *Multi) WriteMissing(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) (uint, error) {
+	var written atomic.Uint32
+	err := m.each(func(name string, writer influx.MetricsWriter) error {
+		if checker, ok := writer.(influx.PointChecker); ok {
+			if has, err := checker.HasPoint(reportTime); err != nil || has {
+				return err
+			}
+		}
+		if err := writer.Write(metrics, reportTime, logger.With("sink", name)); err != nil {
+			return err
+		}
+		written.Add(1)
+		return nil
+	}, false)
+	return uint(written.Load()), err
+}
+
+// WritePoint writes the point to every sink that implements influx.PointWriter
+func (m *Multi) WritePoint(measurement string, fields map[string]interface{}, pointTime time.Time) error {
+	return m.each(func(_ string, writer influx.MetricsWriter) error {
+		if pointWriter, ok := writer.(influx.PointWriter); ok {
+			return pointWriter.WritePoint(measurement, fields, pointTime)
+		}
+		return nil
+	}, false)
+}
+
+// ObserveScrape informs every sink that implements influx.ScrapeObserver about the scrape
+func (m *Multi) ObserveScrape(err error, scrapeTime time.Time) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, w := range m.writers {
+		if observer, ok := w.writer.(influx.ScrapeObserver); ok {
+			observer.ObserveScrape(err, scrapeTime)
+		}
+	}
+}
+
+// each runs the function for every sink concurrently and joins the errors, observed calls are reported to the observer
+func (m *Multi) each(function func(string, influx.MetricsWriter) error, observe bool) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	errs := make([]error, len(m.writers))
+	var wg sync.WaitGroup
+	for i := range m.writers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			err := function(m.writers[i].name, m.writers[i].writer)
+			if observe && m.observer != nil {
+				m.observer(m.writers[i].name, time.Since(start), err)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("sink %s: %w", m.writers[i].name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,245 @@
+package sink
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"solar-scraper/internal/graphite"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/prometheus"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testWriter struct {
+	err     error
+	mutex   sync.Mutex
+	written []influx.SolarMetrics
+}
+
+func (w *testWriter) Ping() error {
+	return w.err
+}
+
+func (w *testWriter) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.written = append(w.written, metrics)
+	return nil
+}
+
+// checkingWriter is a testWriter that already has the points at the times in present
+type checkingWriter struct {
+	testWriter
+	present map[time.Time]bool
+}
+
+func (w *checkingWriter) HasPoint(reportTime time.Time) (bool, error) {
+	return w.present[reportTime], nil
+}
+
+func Test_Multi_WriteMissing(t *testing.T) {
+	metrics := influx.SolarMetrics{Now: 20, Today: 120, Total: 1220}
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	plain := &testWriter{}
+	checking := &checkingWriter{present: map[time.Time]bool{day: true}}
+	multi := &Multi{}
+	multi.Add("plain", plain)
+	multi.Add("checking", checking)
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	written, err := multi.WriteMissing(metrics, day, discard)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), written)
+	written, err = multi.WriteMissing(metrics, day.Add(time.Minute), discard)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), written)
+	require.Len(t, plain.written, 2)
+	require.Len(t, checking.written, 1)
+}
+
+func Test_Multi_Write(t *testing.T) {
+	metrics := influx.SolarMetrics{Now: 20, Today: 120, Total: 1220}
+	tests := []struct {
+		name    string
+		writers map[string]error
+		err     bool
+	}{
+		{name: "All valid",
+			writers: map[string]error{"a": nil, "b": nil},
+		},
+		{name: "One failing",
+			writers: map[string]error{"a": errors.New("test error"), "b": nil, "c": nil},
+			err:     true,
+		},
+		{name: "All failing",
+			writers: map[string]error{"a": errors.New("test error"), "b": errors.New("test error")},
+			err:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			multi := &Multi{}
+			writers := map[string]*testWriter{}
+			for name, err := range test.writers {
+				writers[name] = &testWriter{err: err}
+				multi.Add(name, writers[name])
+			}
+			err := multi.Write(metrics, time.Now(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+			require.Equal(t, test.err, err != nil, test.name)
+			for name, writer := range writers {
+				if test.writers[name] == nil {
+					require.Equal(t, []influx.SolarMetrics{metrics}, writer.written, test.name)
+				} else {
+					require.ErrorContains(t, err, "sink "+name+": test error", test.name)
+				}
+			}
+		})
+	}
+}
+
+func Test_Collection_Validate(t *testing.T) {
+	validInfluxDB := influx.Settings{Version: 2, Url: "http://localhost:8086", V2: influx.SettingsV2{Organization: "org", Bucket: "bucket"}}
+	tests := []struct {
+		name   string
+		input  Collection
+		output error
+	}{
+		{name: "Valid",
+			input: Collection{"a": {Type: TypeInfluxDB, InfluxDB: validInfluxDB}},
+		},
+		{name: "ErrorNoSinks",
+			input:  Collection{},
+			output: errors.New(ErrorNoSinks),
+		},
+		{name: "ErrorEmptyType",
+			input:  Collection{"a": {InfluxDB: validInfluxDB}},
+			output: errors.New("a.type: " + ErrorEmptyType),
+		},
+		{name: "ErrorInvalidType",
+			input:  Collection{"a": {Type: "invalid"}},
+			output: errors.New("a.type: " + ErrorInvalidType),
+		},
+		{name: "Error invalid sink settings",
+			input:  Collection{"a": {Type: TypeInfluxDB, InfluxDB: validInfluxDB}, "b": {Type: TypeInfluxDB}},
+			output: errors.New("b.influxdb.url: " + influx.ErrorEmptyUrl + "\nb.influxdb.version: " + influx.ErrorInvalidVersion),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.output == nil {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output.Error(), test.name)
+			}
+		})
+	}
+}
+
+func Test_Multi_Update(t *testing.T) {
+	exporter := func(listen string) Settings {
+		return Settings{Type: TypePrometheus, Prometheus: prometheus.Settings{Listen: listen, Path: "/metrics"}}
+	}
+	previous := Collection{"a": exporter("127.0.0.1:0"), "b": exporter("127.0.0.1:0")}
+	tests := []struct {
+		name     string
+		next     Collection
+		replaced map[string]bool
+		err      bool
+	}{
+		{name: "Unchanged",
+			next:     Collection{"a": exporter("127.0.0.1:0"), "b": exporter("127.0.0.1:0")},
+			replaced: map[string]bool{"a": false, "b": false},
+		},
+		{name: "Changed, added and removed",
+			next:     Collection{"a": exporter("127.0.0.1:0"), "b": exporter("localhost:0"), "c": exporter("127.0.0.1:0")},
+			replaced: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{name: "Invalid restores previous",
+			next:     Collection{"a": exporter("127.0.0.1:0"), "b": exporter("invalid")},
+			replaced: map[string]bool{"a": false, "b": true},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			multi, err := previous.CreateWriter()
+			require.NoError(t, err, test.name)
+			defer multi.Close()
+			before := map[string]influx.MetricsWriter{}
+			for _, w := range multi.writers {
+				before[w.name] = w.writer
+			}
+			err = multi.Update(previous, test.next)
+			require.Equal(t, test.err, err != nil, test.name)
+			after := map[string]influx.MetricsWriter{}
+			for _, w := range multi.writers {
+				after[w.name] = w.writer
+			}
+			require.Len(t, after, len(test.replaced), test.name)
+			for name, replaced := range test.replaced {
+				require.Contains(t, after, name, test.name)
+				require.Equal(t, replaced, before[name] != after[name], test.name+" "+name)
+			}
+		})
+	}
+}
+
+func Test_Collection_Open(t *testing.T) {
+	exporter := Settings{Type: TypePrometheus, Prometheus: prometheus.Settings{Listen: "127.0.0.1:0", Path: "/metrics"}}
+	invalid := Settings{Type: TypePrometheus, Prometheus: prometheus.Settings{Listen: "invalid", Path: "/metrics"}}
+	unreachable := Settings{Type: TypeGraphite, Graphite: graphite.Settings{Address: "127.0.0.1:1", Protocol: "tcp", Timeout: 1}}
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A sink that can not be created is kept and created later, an unreachable one is kept
+	multi, err := Collection{"a": exporter, "b": invalid, "c": unreachable}.Open(discard)
+	require.NoError(t, err)
+	defer multi.Close()
+	require.Len(t, multi.writers, 3)
+	require.Equal(t, "a", multi.writers[0].name)
+	require.Equal(t, "b", multi.writers[1].name)
+	require.IsType(t, &pendingWriter{}, multi.writers[1].writer)
+	require.Equal(t, "c", multi.writers[2].name)
+
+	// Reloading unchanged settings does not fail on the sink that could not be created
+	require.NoError(t, multi.Update(Collection{"a": exporter, "b": invalid, "c": unreachable}, Collection{"a": exporter, "b": invalid, "c": unreachable}))
+	require.Len(t, multi.writers, 3)
+
+	_, err = Collection{"b": invalid}.Open(discard)
+	require.EqualError(t, err, ErrorNoWriters)
+}
+
+func Test_pendingWriter(t *testing.T) {
+	// The sink can not listen while the address is in use
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pending := &pendingWriter{settings: Settings{Type: TypePrometheus, Prometheus: prometheus.Settings{Listen: listener.Addr().String(), Path: "/metrics"}}}
+	defer pending.Close()
+	require.Error(t, pending.Ping())
+	require.Nil(t, pending.writer)
+
+	require.NoError(t, listener.Close())
+	require.NoError(t, pending.Ping())
+	require.NotNil(t, pending.writer)
+	created := pending.writer
+	require.NoError(t, pending.Ping())
+	require.Equal(t, created, pending.writer)
+}
+
+func Test_Settings_History(t *testing.T) {
+	for _, sinkType := range []string{TypeFile, TypeGraphite, TypeInfluxDB, TypePostgres, TypePVOutput, TypeSQLite} {
+		require.True(t, Settings{Type: sinkType}.History(), sinkType)
+	}
+	// These only keep or publish the current state
+	for _, sinkType := range []string{TypeMQTT, TypePrometheus, TypeStatsD, TypeWebhook} {
+		require.False(t, Settings{Type: sinkType}.History(), sinkType)
+	}
+}
@@ -0,0 +1,238 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+const (
+	ErrorEmptyPath     string = "empty path"
+	ErrorInvalidPeriod string = "invalid period, expected daily or monthly"
+)
+
+// Supported report periods
+const (
+	PeriodDaily   string = "daily"
+	PeriodMonthly string = "monthly"
+)
+
+const dayFormat string = "2006-01-02"
+
+const schema string = `
+CREATE TABLE IF NOT EXISTS samples (
+	host        TEXT    NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	now         INTEGER,
+	today       REAL    NOT NULL,
+	total       REAL    NOT NULL,
+	substituted INTEGER NOT NULL,
+	PRIMARY KEY (host, timestamp)
+);
+CREATE TABLE IF NOT EXISTS daily_summaries (
+	host        TEXT    NOT NULL,
+	day         TEXT    NOT NULL,
+	yield       REAL    NOT NULL,
+	peak_power  INTEGER,
+	first_total REAL    NOT NULL,
+	last_total  REAL    NOT NULL,
+	samples     INTEGER NOT NULL,
+	substituted INTEGER NOT NULL,
+	PRIMARY KEY (host, day)
+);`
+
+const insertSample string = `INSERT OR IGNORE INTO samples (host, timestamp, now, today, total, substituted) VALUES (?, ?, ?, ?, ?, ?)`
+
+const selectSample string = `SELECT count(*) FROM samples WHERE host = ? AND timestamp = ?`
+
+const upsertSummary string = `
+INSERT INTO daily_summaries (host, day, yield, peak_power, first_total, last_total, samples, substituted)
+VALUES (?, ?, ?, ?, ?, ?, 1, ?)
+ON CONFLICT (host, day) DO UPDATE SET
+	yield       = max(yield, excluded.yield),
+	peak_power  = CASE WHEN peak_power IS NULL OR excluded.peak_power > peak_power THEN excluded.peak_power ELSE peak_power END,
+	first_total = min(first_total, excluded.first_total),
+	last_total  = max(last_total, excluded.last_total),
+	samples     = samples + 1,
+	substituted = substituted + excluded.substituted`
+
+const dailyReport string = `
+SELECT day, yield, peak_power, samples, substituted FROM daily_summaries
+WHERE host = ? ORDER BY day`
+
+const monthlyReport string = `
+SELECT substr(day, 1, 7) AS month, sum(yield), max(peak_power), count(*) FROM daily_summaries
+WHERE host = ? GROUP BY month ORDER BY month`
+
+// Settings is the configuration for the SQLite storage
+type Settings struct {
+	Path string      `mapstructure:"path"`
+	Tags influx.Tags `mapstructure:"tags"`
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".path", "solar-scraper.db")
+	s.Tags.Defaults(v, setting+".tags")
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Path == "" {
+		errs = append(errs, validation.New("path", ErrorEmptyPath))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateWriter opens the database and creates the schema when needed
+func (s Settings) CreateWriter() (*Writer, error) {
+	db, err := open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{db: db, tags: s.Tags}, nil
+}
+
+// PrintReport prints the yield per day or per month as a table
+func (s Settings) PrintReport(period string, w io.Writer) error {
+	db, err := open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	switch period {
+	case PeriodDaily:
+		err = printDaily(db, s.Tags.Host, table)
+	case PeriodMonthly:
+		err = printMonthly(db, s.Tags.Host, table)
+	default:
+		err = errors.New(ErrorInvalidPeriod)
+	}
+	if err != nil {
+		return err
+	}
+	return table.Flush()
+}
+
+func open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Writer is a MetricsWriter that stores the metrics in a SQLite database
+type Writer struct {
+	db   *sql.DB
+	tags influx.Tags
+}
+
+// Ping checks if the database is reachable
+func (w *Writer) Ping() error {
+	return w.db.Ping()
+}
+
+// Write stores the sample and updates the summary of the day, samples that are already stored are ignored
+func (w *Writer) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) (err error) {
+	var now sql.NullInt64
+	if !metrics.NowNil {
+		now = sql.NullInt64{Int64: int64(metrics.Now), Valid: true}
+	}
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	result, err := tx.Exec(insertSample, w.tags.Host, reportTime.Unix(), now, metrics.Today, metrics.Total, metrics.NowNil)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+	_, err = tx.Exec(upsertSummary, w.tags.Host, reportTime.Local().Format(dayFormat), metrics.Today, now, metrics.Total, metrics.Total, metrics.NowNil)
+	return err
+}
+
+// Close closes the database
+func (w *Writer) Close() error {
+	return w.db.Close()
+}
+
+// HasPoint checks if a sample with the report time is stored
+func (w *Writer) HasPoint(reportTime time.Time) (bool, error) {
+	var count int
+	err := w.db.QueryRow(selectSample, w.tags.Host, reportTime.Unix()).Scan(&count)
+	return count > 0, err
+}
+
+func printDaily(db *sql.DB, host string, w io.Writer) error {
+	rows, err := db.Query(dailyReport, host)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fmt.Fprintln(w, "Day\tYield (kWh)\tPeak (W)\tSamples\tSubstituted\t")
+	for rows.Next() {
+		var day string
+		var yield float64
+		var peak sql.NullInt64
+		var samples, substituted int64
+		if err := rows.Scan(&day, &yield, &peak, &samples, &substituted); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%.2f\t%s\t%d\t%d\t\n", day, yield, formatPeak(peak), samples, substituted)
+	}
+	return rows.Err()
+}
+
+func printMonthly(db *sql.DB, host string, w io.Writer) error {
+	rows, err := db.Query(monthlyReport, host)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fmt.Fprintln(w, "Month\tYield (kWh)\tPeak (W)\tDays\t")
+	for rows.Next() {
+		var month string
+		var yield float64
+		var peak sql.NullInt64
+		var days int64
+		if err := rows.Scan(&month, &yield, &peak, &days); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%.2f\t%s\t%d\t\n", month, yield, formatPeak(peak), days)
+	}
+	return rows.Err()
+}
+
+func formatPeak(peak sql.NullInt64) string {
+	if !peak.Valid {
+		return "-"
+	}
+	return fmt.Sprint(peak.Int64)
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Writer(t *testing.T) {
+	settings := Settings{Path: filepath.Join(t.TempDir(), "test.db"), Tags: influx.Tags{Host: "my-host"}}
+	writer, err := settings.CreateWriter()
+	require.NoError(t, err)
+	require.NoError(t, writer.Ping())
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	input := []struct {
+		metrics    influx.SolarMetrics
+		reportTime time.Time
+	}{
+		{metrics: influx.SolarMetrics{Now: 150, Today: 1.5, Total: 100}, reportTime: day},
+		{metrics: influx.SolarMetrics{Now: 300, Today: 2.0, Total: 100.5}, reportTime: day.Add(time.Minute)},
+		// Written twice, must be ignored the second time
+		{metrics: influx.SolarMetrics{Now: 300, Today: 2.0, Total: 100.5}, reportTime: day.Add(time.Minute)},
+		{metrics: influx.SolarMetrics{NowNil: true, Today: 2.0, Total: 100.5}, reportTime: day.Add(2 * time.Minute)},
+		{metrics: influx.SolarMetrics{Now: 50, Today: 4.25, Total: 104.75}, reportTime: day.AddDate(0, 0, 1)},
+		{metrics: influx.SolarMetrics{NowNil: true, Today: 1, Total: 105.75}, reportTime: day.AddDate(0, 1, 0)},
+	}
+	for _, e := range input {
+		require.NoError(t, writer.Write(e.metrics, e.reportTime, discard))
+	}
+	has, err := writer.HasPoint(day.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = writer.HasPoint(day.Add(3 * time.Minute))
+	require.NoError(t, err)
+	require.False(t, has)
+	require.NoError(t, writer.Close())
+
+	tests := []struct {
+		name   string
+		period string
+		output string
+		err    string
+	}{
+		{name: "Daily",
+			period: PeriodDaily,
+			output: `         Day  Yield (kWh)  Peak (W)  Samples  Substituted
+  2023-06-01         2.00       300        3            1
+  2023-06-02         4.25        50        1            0
+  2023-07-01         1.00         -        1            1
+`,
+		},
+		{name: "Monthly",
+			period: PeriodMonthly,
+			output: `    Month  Yield (kWh)  Peak (W)  Days
+  2023-06         6.25       300     2
+  2023-07         1.00         -     1
+`,
+		},
+		{name: "ErrorInvalidPeriod",
+			period: "yearly",
+			err:    ErrorInvalidPeriod,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			var output bytes.Buffer
+			err := settings.PrintReport(test.period, &output)
+			if test.err != "" {
+				require.EqualError(t, err, test.err, test.name)
+				return
+			}
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.output, output.String(), test.name)
+		})
+	}
+}
+
+func Test_Writer_totals(t *testing.T) {
+	settings := Settings{Path: filepath.Join(t.TempDir(), "test.db"), Tags: influx.Tags{Host: "my-host"}}
+	writer, err := settings.CreateWriter()
+	require.NoError(t, err)
+	defer writer.Close()
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	// A backfill writes the readings of the day out of order
+	require.NoError(t, writer.Write(influx.SolarMetrics{Now: 100, Today: 2.0, Total: 102}, day.Add(time.Hour), discard))
+	require.NoError(t, writer.Write(influx.SolarMetrics{Now: 100, Today: 3.0, Total: 103}, day.Add(2*time.Hour), discard))
+	require.NoError(t, writer.Write(influx.SolarMetrics{Now: 100, Today: 1.0, Total: 101}, day, discard))
+	var first, last float64
+	require.NoError(t, writer.db.QueryRow(`SELECT first_total, last_total FROM daily_summaries WHERE host = ?`, "my-host").Scan(&first, &last))
+	require.Equal(t, 101.0, first)
+	require.Equal(t, 103.0, last)
+}
@@ -2,6 +2,7 @@ package timer
 
 import (
 	"errors"
+	"solar-scraper/internal/validation"
 	"strings"
 	"time"
 
@@ -24,10 +25,10 @@ type Settings struct {
 }
 
 // Defaults sets the default values for the settings
-func (s Settings) Defaults(setting string) {
-	viper.SetDefault(setting+".end", "23:59:59")
-	viper.SetDefault(setting+".start", "00:00:00")
-	viper.SetDefault(setting+".polling_interval", uint(60))
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".end", "23:59:59")
+	v.SetDefault(setting+".start", "00:00:00")
+	v.SetDefault(setting+".polling_interval", uint(60))
 }
 
 // GetEndTime returns the end time
@@ -41,17 +42,20 @@ func (s Settings) GetStartTime() timeObject {
 }
 
 // Validate checks if the settings are valid
-func (s *Settings) Validate() (err error) {
+func (s *Settings) Validate() error {
+	var errs []error
+	var err error
 	if s.PollingIntervalInSeconds == 0 {
-		return errors.New(ErrorPollingInterval)
+		errs = append(errs, validation.New("polling_interval", ErrorPollingInterval))
 	}
-	s.end, err = parse(s.End)
-	if err != nil {
-		return
+	if s.end, err = parse(s.End); err != nil {
+		errs = append(errs, validation.Field("end", err))
 	}
-	s.start, err = parse(s.Start)
-	if err != nil {
-		return
+	if s.start, err = parse(s.Start); err != nil {
+		errs = append(errs, validation.Field("start", err))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
 	return s.validateTimeFrameSize()
 }
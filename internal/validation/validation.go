@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"errors"
+)
+
+// Error is the error of a single setting, identified by its path in the config file
+type Error struct {
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Field adds the name of the field in front of the path of every error in err.
+// Errors joined with errors.Join stay separate errors, a nil error stays nil.
+func Field(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		fields := make([]error, len(errs))
+		for i := range errs {
+			fields[i] = Field(name, errs[i])
+		}
+		return errors.Join(fields...)
+	}
+	if fieldErr, ok := err.(*Error); ok {
+		return &Error{Path: name + "." + fieldErr.Path, Err: fieldErr.Err}
+	}
+	return &Error{Path: name, Err: err}
+}
+
+// New returns an error for the field with the message
+func New(name, message string) error {
+	return &Error{Path: name, Err: errors.New(message)}
+}
@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Field(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  error
+		output string
+	}{
+		{name: "Nil",
+			input: nil,
+		},
+		{name: "Plain error",
+			input:  errors.New("empty url"),
+			output: "influxdb: empty url",
+		},
+		{name: "Nested field",
+			input:  Field("v2", New("bucket", "empty bucket")),
+			output: "influxdb.v2.bucket: empty bucket",
+		},
+		{name: "Joined errors",
+			input:  errors.Join(New("url", "empty url"), Field("v2", New("org", "empty org"))),
+			output: "influxdb.url: empty url\ninfluxdb.v2.org: empty org",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := Field("influxdb", test.input)
+			if test.output == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.output, test.name)
+			}
+		})
+	}
+}
+
+func Test_Field_Unwrap(t *testing.T) {
+	cause := errors.New("empty url")
+	err := Field("influxdb", Field("v2", cause))
+	require.ErrorIs(t, err, cause)
+	var fieldErr *Error
+	require.ErrorAs(t, err, &fieldErr)
+	require.Equal(t, "influxdb.v2", fieldErr.Path)
+}
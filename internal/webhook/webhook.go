@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"solar-scraper/internal/influx"
+	"solar-scraper/internal/validation"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ErrorEmptyUrl    string = "empty url"
+	ErrorEmptyMethod string = "empty method"
+	ErrorEvery       string = "every must be greater than 0"
+)
+
+const defaultBody string = `{"host":{{json .Host}},"timestamp":{{json .Timestamp}},"now":{{if .Substituted}}null{{else}}{{.Now}}{{end}},"today":{{.Today}},"total":{{.Total}},"substituted":{{.Substituted}}}`
+
+// retryDelay is the wait before the first retry, it doubles with every further retry
+var retryDelay = time.Second
+
+var templateFunctions = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// Settings is the configuration for the webhook
+type Settings struct {
+	Body        string            `mapstructure:"body"` // Go template, executed with Data
+	ContentType string            `mapstructure:"content_type"`
+	Every       uint              `mapstructure:"every"` // Only send every Nth reading
+	Headers     map[string]string `mapstructure:"headers" secret:"true"`
+	Method      string            `mapstructure:"method"`
+	OnChange    bool              `mapstructure:"on_change"` // Only send readings that differ from the last one sent
+	Retry       uint              `mapstructure:"retry"`
+	Tags        influx.Tags       `mapstructure:"tags"`
+	Timeout     uint              `mapstructure:"timeout"`
+	Url         string            `mapstructure:"url"`
+}
+
+// Data is the data available in the body template
+type Data struct {
+	Host        string
+	Now         uint
+	Substituted bool
+	Timestamp   time.Time
+	Today       float64
+	Total       float64
+}
+
+// Defaults sets the default values for the settings
+func (s Settings) Defaults(v *viper.Viper, setting string) {
+	v.SetDefault(setting+".body", defaultBody)
+	v.SetDefault(setting+".content_type", "application/json")
+	v.SetDefault(setting+".every", uint(1))
+	v.SetDefault(setting+".method", http.MethodPost)
+	v.SetDefault(setting+".on_change", false)
+	v.SetDefault(setting+".retry", uint(2))
+	s.Tags.Defaults(v, setting+".tags")
+	v.SetDefault(setting+".timeout", uint(5))
+}
+
+// Validate checks if the settings are valid
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Url == "" {
+		errs = append(errs, validation.New("url", ErrorEmptyUrl))
+	}
+	if s.Method == "" {
+		errs = append(errs, validation.New("method", ErrorEmptyMethod))
+	}
+	if s.Every == 0 {
+		errs = append(errs, validation.New("every", ErrorEvery))
+	}
+	if _, err := s.parseBody(); err != nil {
+		errs = append(errs, validation.Field("body", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (s Settings) parseBody() (*template.Template, error) {
+	return template.New("body").Funcs(templateFunctions).Parse(s.Body)
+}
+
+// CreateWriter creates the webhook writer
+func (s Settings) CreateWriter() (*Writer, error) {
+	body, err := s.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		settings: s,
+		body:     body,
+		client:   &http.Client{Timeout: time.Duration(s.Timeout) * time.Second},
+	}, nil
+}
+
+// Writer is a MetricsWriter that sends the metrics to an HTTP endpoint
+type Writer struct {
+	settings Settings
+	body     *template.Template
+	client   *http.Client
+	mutex    sync.Mutex
+	count    uint
+	last     *influx.SolarMetrics
+}
+
+// Ping always succeeds, webhooks do not have a generic way to check if they are reachable
+func (w *Writer) Ping() error {
+	return nil
+}
+
+// Write sends the metrics, unless they are skipped by the every or on change settings
+func (w *Writer) Write(metrics influx.SolarMetrics, reportTime time.Time, logger *slog.Logger) (err error) {
+	if w.skip(metrics) {
+		return nil
+	}
+	var body bytes.Buffer
+	if err = w.body.Execute(&body, Data{
+		Host:        w.settings.Tags.Host,
+		Now:         metrics.Now,
+		Substituted: metrics.NowNil,
+		Timestamp:   reportTime,
+		Today:       metrics.Today,
+		Total:       metrics.Total,
+	}); err != nil {
+		return err
+	}
+	delay := retryDelay
+	for i := -1; i < int(w.settings.Retry); i++ {
+		if i > -1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = w.send(body.Bytes()); err == nil {
+			w.sent(metrics)
+			break
+		}
+	}
+	return
+}
+
+// skip counts the reading and checks if it should be sent
+func (w *Writer) skip(metrics influx.SolarMetrics) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count++
+	if (w.count-1)%w.settings.Every != 0 {
+		return true
+	}
+	return w.settings.OnChange && w.last != nil && *w.last == metrics
+}
+
+// sent records the reading that was accepted by the endpoint, a failed reading is not skipped as unchanged
+func (w *Writer) sent(metrics influx.SolarMetrics) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.last = &metrics
+}
+
+func (w *Writer) send(body []byte) error {
+	req, err := http.NewRequest(w.settings.Method, w.settings.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.settings.ContentType)
+	for key, value := range w.settings.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
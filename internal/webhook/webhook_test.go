@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"solar-scraper/internal/influx"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// newTestServer returns a server that fails the first failures requests
+func newTestServer(failures int, requests *[]received) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, received{method: r.Method, header: r.Header, body: string(body)})
+		if len(*requests) <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+}
+
+func Test_Writer_Write(t *testing.T) {
+	retryDelay = time.Millisecond
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reportTime := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	reading := influx.SolarMetrics{Now: 150, Today: 3.1, Total: 4756.2}
+	tests := []struct {
+		name     string
+		settings Settings
+		failures int
+		input    []influx.SolarMetrics
+		output   []string
+		err      bool
+	}{
+		{name: "Default body",
+			settings: Settings{Body: defaultBody},
+			input:    []influx.SolarMetrics{reading, {NowNil: true, Today: 3.1, Total: 4756.2}},
+			output: []string{
+				`{"host":"my-host","timestamp":"2023-06-01T12:00:00Z","now":150,"today":3.1,"total":4756.2,"substituted":false}`,
+				`{"host":"my-host","timestamp":"2023-06-01T12:00:00Z","now":null,"today":3.1,"total":4756.2,"substituted":true}`,
+			},
+		},
+		{name: "Custom body",
+			settings: Settings{Body: `power={{.Now}}&day={{.Timestamp.Format "2006-01-02"}}`},
+			input:    []influx.SolarMetrics{reading},
+			output:   []string{`power=150&day=2023-06-01`},
+		},
+		{name: "Every 2nd",
+			settings: Settings{Body: `{{.Now}}`, Every: 2},
+			input:    []influx.SolarMetrics{{Now: 1}, {Now: 2}, {Now: 3}, {Now: 4}, {Now: 5}},
+			output:   []string{"1", "3", "5"},
+		},
+		{name: "On change",
+			settings: Settings{Body: `{{.Now}}`, OnChange: true},
+			input:    []influx.SolarMetrics{{Now: 1}, {Now: 1}, {Now: 2}, {Now: 2}, {Now: 1}},
+			output:   []string{"1", "2", "1"},
+		},
+		{name: "On change after failed send",
+			settings: Settings{Body: `{{.Now}}`, OnChange: true},
+			failures: 1,
+			input:    []influx.SolarMetrics{{Now: 1}, {Now: 1}, {Now: 1}, {Now: 2}},
+			output:   []string{"1", "1", "2"},
+		},
+		{name: "Retry",
+			settings: Settings{Body: `{{.Now}}`, Retry: 2},
+			failures: 2,
+			input:    []influx.SolarMetrics{reading},
+			output:   []string{"150", "150", "150"},
+		},
+		{name: "Error retries exhausted",
+			settings: Settings{Body: `{{.Now}}`, Retry: 1},
+			failures: 2,
+			input:    []influx.SolarMetrics{reading},
+			output:   []string{"150", "150"},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			var requests []received
+			server := newTestServer(test.failures, &requests)
+			defer server.Close()
+			settings := test.settings
+			settings.Url = server.URL
+			settings.Method = http.MethodPut
+			settings.ContentType = "application/json"
+			settings.Headers = map[string]string{"authorization": "Bearer token"}
+			settings.Tags = influx.Tags{Host: "my-host"}
+			if settings.Every == 0 {
+				settings.Every = 1
+			}
+			writer, err := settings.CreateWriter()
+			require.NoError(t, err, test.name)
+			for _, metrics := range test.input {
+				err = writer.Write(metrics, reportTime, discard)
+			}
+			require.Equal(t, test.err, err != nil, test.name)
+			bodies := make([]string, len(requests))
+			for i, r := range requests {
+				bodies[i] = r.body
+				require.Equal(t, http.MethodPut, r.method, test.name)
+				require.Equal(t, "Bearer token", r.header.Get("Authorization"), test.name)
+				require.Equal(t, "application/json", r.header.Get("Content-Type"), test.name)
+			}
+			require.Equal(t, test.output, bodies, test.name)
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Settings
+		err   string
+	}{
+		{name: "Valid",
+			input: Settings{Url: "http://localhost", Method: http.MethodPost, Every: 1, Body: defaultBody},
+		},
+		{name: "ErrorEmptyUrl",
+			input: Settings{Method: http.MethodPost, Every: 1},
+			err:   "url: " + ErrorEmptyUrl,
+		},
+		{name: "ErrorEmptyMethod",
+			input: Settings{Url: "http://localhost", Every: 1},
+			err:   "method: " + ErrorEmptyMethod,
+		},
+		{name: "ErrorEvery",
+			input: Settings{Url: "http://localhost", Method: http.MethodPost},
+			err:   "every: " + ErrorEvery,
+		},
+		{name: "Error invalid template",
+			input: Settings{Url: "http://localhost", Method: http.MethodPost, Every: 1, Body: "{{.Now"},
+			err:   `body: template: body:1: unclosed action`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(*testing.T) {
+			err := test.input.Validate()
+			if test.err == "" {
+				require.NoError(t, err, test.name)
+			} else {
+				require.EqualError(t, err, test.err, test.name)
+			}
+		})
+	}
+}
@@ -1,24 +1,149 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
 	"solar-scraper/internal/config"
 	"solar-scraper/internal/flags"
 	"solar-scraper/internal/logger"
 	"solar-scraper/internal/scheduler"
+	"solar-scraper/internal/sink"
+)
+
+const (
+	ErrorUnknownCommand  string = "unknown command"
+	ErrorRestartRequired string = "changes to the health, alerts and log settings are applied after a restart"
 )
 
 var version string // Set by build script
 
 func main() {
 	options := flags.Parse(version)
-	log := logger.New(options.Log, options.Debug)
+	// The schema describes the config, so it is printed without reading one
+	if options.Command == flags.CommandSchema {
+		if err := schema(); err != nil {
+			fatal(newLogger(options, logger.Settings{}), err)
+		}
+		return
+	}
 	config, err := config.Get(options.Config)
 	if err != nil {
-		log.Error.Fatal(err)
+		// Without a config only the command line options configure the logger
+		fatal(newLogger(options, logger.Settings{}), err)
+	}
+	log := newLogger(options, config.Log)
+	if err = command(options, config, log); err != nil {
+		fatal(log, err)
+	}
+}
+
+// newLogger creates the logger from the log settings overridden by the command line options
+func newLogger(options flags.Options, settings logger.Settings) *slog.Logger {
+	if options.Log != "" {
+		settings.Output = logger.OutputFile
+		settings.File = options.Log
+	}
+	if options.LogOutput != "" {
+		settings.Output = options.LogOutput
 	}
-	metricsWriter := config.InfluxDB.CreateWriter()
-	if err = metricsWriter.Ping(); err != nil {
-		log.Error.Fatal(err)
+	if options.LogFormat != "" {
+		settings.Format = options.LogFormat
 	}
-	scheduler.Run(config.Time, config.Scraper, metricsWriter, log.Debug, log.Error)
+	if options.LogLevel != "" {
+		settings.Level = options.LogLevel
+	}
+	if options.Debug {
+		settings.Level = slog.LevelDebug.String()
+	}
+	log, err := logger.New(settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return log
+}
+
+// fatal logs the error and exits
+func fatal(log *slog.Logger, err error) {
+	log.Error(err.Error())
+	os.Exit(1)
+}
+
+func command(options flags.Options, config config.Settings, log *slog.Logger) error {
+	switch options.Command {
+	case flags.CommandRun:
+		return run(options, config, log)
+	case flags.CommandOnce:
+		return once(config, options.Args, log)
+	case flags.CommandPing:
+		return ping(config, log)
+	case flags.CommandValidate:
+		return validate()
+	case flags.CommandPrintConfig:
+		return printConfig(config)
+	case flags.CommandReport:
+		return report(config.Sinks, options.Args)
+	case flags.CommandBackfill:
+		return runBackfill(config, options.Args, log)
+	case flags.CommandReplay:
+		return replay(config, options.Args, log)
+	}
+	return errors.New(ErrorUnknownCommand + ": " + options.Command)
+}
+
+// run scrapes the inverter in the polling window until the process is stopped
+func run(options flags.Options, config config.Settings, log *slog.Logger) error {
+	metricsWriter, err := config.Sinks.Open(log)
+	if err != nil {
+		return err
+	}
+	tracker := config.Health.NewTracker(metricsWriter.Ping)
+	metricsWriter.SetObserver(tracker.ObserveSinkWrite)
+	server, err := config.Health.Serve(tracker)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	alerts, err := config.Alerts.CreateEngine(log)
+	if err != nil {
+		return err
+	}
+	defer alerts.Close()
+	updates, watcher, err := watch(options.Config, config, metricsWriter, log)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	scheduler.Run(config.Scheduler(), metricsWriter, tracker, alerts, updates, log)
+	return nil
+}
+
+// watch applies changes of the config file to the sinks and passes the scheduler settings to the returned channel
+func watch(configPath string, current config.Settings, metricsWriter *sink.Multi, log *slog.Logger) (<-chan scheduler.Settings, *config.Watcher, error) {
+	// The channel holds the latest settings the scheduler did not pick up yet, so the watcher never blocks
+	updates := make(chan scheduler.Settings, 1)
+	watcher, err := config.Watch(configPath, current, func(previous, next config.Settings) error {
+		if err := metricsWriter.Update(previous.Sinks, next.Sinks); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(previous.Health, next.Health) || !reflect.DeepEqual(previous.Alerts, next.Alerts) ||
+			!reflect.DeepEqual(previous.Log, next.Log) {
+			log.Warn(ErrorRestartRequired)
+		}
+		if reflect.DeepEqual(previous.Scheduler(), next.Scheduler()) {
+			return nil
+		}
+		for {
+			select {
+			case updates <- next.Scheduler():
+				return nil
+			case <-updates:
+				// Replaced by the newer settings
+			}
+		}
+	}, log)
+	return updates, watcher, err
 }